@@ -0,0 +1,172 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// archiveExts are the file extensions of the supported archive formats.
+var archiveExts = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// splitArchive splits a location such as "vendor/partner.zip!/openapi/common.yml"
+// into the path of the archive and the path of the member inside the archive.
+func splitArchive(pth string) (archive string, member string, isArchived bool) {
+	for i := 0; ; {
+		j := strings.Index(pth[i:], "!/")
+		if j < 0 {
+			return "", "", false
+		}
+		i += j
+		for _, ext := range archiveExts {
+			if strings.HasSuffix(pth[:i], ext) {
+				return pth[:i], pth[i+2:], true
+			}
+		}
+		i += 2
+	}
+}
+
+// openArchive opens the archive at pth (a local path or URL). The archive is
+// loaded once and kept in cache.
+func (ld *loader) openArchive(pth string) (fs.FS, error) {
+	if fsys, ok := ld.archives[pth]; ok {
+		return fsys, nil
+	}
+
+	data, err := loadBytes(ld.FS(), pth)
+	if err != nil {
+		return nil, err
+	}
+
+	var fsys fs.FS
+	switch {
+	case strings.HasSuffix(pth, ".zip"):
+		fsys, err = zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	case strings.HasSuffix(pth, ".tar"):
+		fsys, err = readTar(bytes.NewReader(data))
+	default: // .tar.gz, .tgz
+		var r io.Reader
+		r, err = gzip.NewReader(bytes.NewReader(data))
+		if err == nil {
+			fsys, err = readTar(r)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", pth, err)
+	}
+
+	if ld.archives == nil {
+		ld.archives = make(map[string]fs.FS)
+	}
+	ld.archives[pth] = fsys
+	return fsys, nil
+}
+
+// loadArchived loads a document from an archive. member may have a "?doc=N" suffix.
+func (ld *loader) loadArchived(archive string, member string, pos positions) (*object, error) {
+	member, doc, err := splitDocSelector(member)
+	if err != nil {
+		return nil, err
+	}
+	fsys, err := ld.openArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fsys.Open(member)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return loadNamed(f, member, doc, pos)
+}
+
+// loadArchivedBytes loads the raw content of a file from an archive.
+func (ld *loader) loadArchivedBytes(archive string, member string) ([]byte, error) {
+	fsys, err := ld.openArchive(archive)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(fsys, member)
+}
+
+// readTar reads the regular files of a tar archive into memory.
+func readTar(r io.Reader) (fs.FS, error) {
+	files := make(memFS)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(strings.TrimPrefix(hdr.Name, "/"))] = &memFile{
+			name:    path.Base(hdr.Name),
+			data:    data,
+			modTime: hdr.ModTime,
+		}
+	}
+}
+
+// memFS is a read-only in-memory file system made only of regular files.
+type memFS map[string]*memFile
+
+func (m memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	f, ok := m[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &openMemFile{memFile: f, Reader: bytes.NewReader(f.data)}, nil
+}
+
+type memFile struct {
+	name    string
+	data    []byte
+	modTime time.Time
+}
+
+// memFile implements fs.FileInfo.
+func (f *memFile) Name() string       { return f.name }
+func (f *memFile) Size() int64        { return int64(len(f.data)) }
+func (f *memFile) Mode() fs.FileMode  { return 0o444 }
+func (f *memFile) ModTime() time.Time { return f.modTime }
+func (f *memFile) IsDir() bool        { return false }
+func (f *memFile) Sys() any           { return nil }
+
+type openMemFile struct {
+	*memFile
+	*bytes.Reader
+}
+
+func (f *openMemFile) Stat() (fs.FileInfo, error) {
+	return f.memFile, nil
+}
+
+func (f *openMemFile) Close() error {
+	if f.Reader == nil {
+		return fs.ErrClosed
+	}
+	f.Reader = nil
+	return nil
+}
+
+var _ fs.File = (*openMemFile)(nil)
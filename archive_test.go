@@ -0,0 +1,122 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitArchive(t *testing.T) {
+	for _, tc := range []struct {
+		pth, archive, member string
+	}{
+		{"/a/p.zip!/openapi/common.yml", "/a/p.zip", "openapi/common.yml"},
+		{"/a/p.tar.gz!/common.yml?doc=2", "/a/p.tar.gz", "common.yml?doc=2"},
+		{"/a/b!/p.tgz!/x.yml", "/a/b!/p.tgz", "x.yml"},
+		{"https://example.com/p.tar!/x.yml", "https://example.com/p.tar", "x.yml"},
+		{"/a/p.zip", "", ""},
+		{"/a/p!/x.yml", "", ""},
+	} {
+		archive, member, _ := splitArchive(tc.pth)
+		assertString(t, archive, tc.archive)
+		assertString(t, member, tc.member)
+	}
+}
+
+// writeArchives creates partner.zip and partner.tar.gz in dir with the content of testdata/common.
+func writeArchives(t *testing.T, dir string) {
+	files, err := filepath.Glob("testdata/common/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fz, err := os.Create(filepath.Join(dir, "partner.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fz.Close()
+	zw := zip.NewWriter(fz)
+
+	ft, err := os.Create(filepath.Join(dir, "partner.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ft.Close()
+	gw := gzip.NewWriter(ft)
+	tw := tar.NewWriter(gw)
+
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := "openapi/" + filepath.Base(f)
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data))})
+		tw.Write(data)
+	}
+
+	for _, c := range []io.Closer{zw, tw, gw} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestExpandRefsArchive(t *testing.T) {
+	dir := t.TempDir()
+	writeArchives(t, dir)
+
+	expected, err := loadFile("testdata/43-inline-overrides-deep/result.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, archive := range []string{"partner.zip", "partner.tar.gz"} {
+		inputPath := filepath.Join(dir, "input.yml")
+		err := os.WriteFile(inputPath, []byte(`---
+swagger: "2.0"
+info:
+  $inline: `+archive+`!/openapi/info.yml#/info
+  license:
+    $inline: `+archive+`!/openapi/license-apache2.json
+  version: "0.0.1"
+paths:
+  $ref: `+archive+`!/openapi/root-404.yml#/paths
+`), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ld loader
+		var out interface{}
+		err = processFile(inputPath, &ld, func(result interface{}) error {
+			out = result
+			return nil
+		}, &options{})
+		if err != nil {
+			t.Fatalf("%s: %v", archive, err)
+		}
+		if !equalJSON(out, expected) {
+			t.Errorf("%s: output doesn't match: %#v", archive, out)
+		}
+		if len(ld.archives) != 1 {
+			t.Errorf("%s: archive loaded %d times", archive, len(ld.archives))
+		}
+
+		_, err = ld.Load(filepath.ToSlash(filepath.Join(dir, archive)) + "!/openapi/missing.yml")
+		if err == nil {
+			t.Errorf("%s: error expected", archive)
+		} else {
+			t.Log(err)
+		}
+	}
+}
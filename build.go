@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// configName is the default name of the project config file (see [loadConfig]).
+const configName = ".openapi-preprocessor.yaml"
+
+// buildTarget is a spec to build, as described in the project config file.
+type buildTarget struct {
+	Name       string            `yaml:"-"`
+	Input      string            `yaml:"input"`
+	Output     string            `yaml:"output"`
+	Format     string            `yaml:"format"`     // json, yaml or canonical (default: from the extension of Output)
+	Transforms []string          `yaml:"transforms"` // see [targetTransforms]
+	Filters    *filters          `yaml:"filters"`
+	Variables  map[string]string `yaml:"variables"` // for ${NAME} interpolation
+	GroupBy    string            `yaml:"group-by"`  // tag or path: one output per group (see [Groups])
+}
+
+// targetTransforms are the transforms a target may enable.
+var targetTransforms = map[string]func(*options){
+	"bundle":      func(opts *options) { opts.bundle = true },
+	"dereference": func(opts *options) { opts.dereference = true },
+	"keep-cycles": func(opts *options) { opts.keepCycles = true },
+}
+
+// loadConfig loads the project config file which lists the build targets:
+//
+//	targets:
+//	  public:
+//	    input: api/openapi.yaml
+//	    output: dist/public.json
+//	    transforms: [dereference]
+//	    filters:
+//	      exclude-tags: [internal]
+//	    variables:
+//	      SERVER_URL: https://api.example.com
+//
+// Targets are returned in the order of the file. Relative paths are relative
+// to the directory of the config file. The input may also be an http:// or
+// https:// URL.
+func loadConfig(name string) ([]*buildTarget, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Targets map[string]*buildTarget `yaml:"targets"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err = dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	// Decode again for the order of targets
+	var order struct {
+		Targets yaml.Node `yaml:"targets"`
+	}
+	if err = yaml.Unmarshal(data, &order); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if len(config.Targets) == 0 {
+		return nil, fmt.Errorf("%s: no targets", name)
+	}
+
+	dir := filepath.Dir(name)
+	targets := make([]*buildTarget, 0, len(config.Targets))
+	for i := 0; i < len(order.Targets.Content); i += 2 {
+		t := config.Targets[order.Targets.Content[i].Value]
+		if t == nil {
+			return nil, fmt.Errorf("%s: line %d: empty target", name, order.Targets.Content[i].Line)
+		}
+		t.Name = order.Targets.Content[i].Value
+		if err = t.check(); err != nil {
+			return nil, fmt.Errorf("%s: target %q: %v", name, t.Name, err)
+		}
+		if !isRemote(t.Input) {
+			t.Input = relativeTo(dir, t.Input)
+		}
+		t.Output = relativeTo(dir, t.Output)
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+// relativeTo returns the OS path of pth (slash separated) resolved against
+// dir if pth is relative.
+func relativeTo(dir string, pth string) string {
+	pth = filepath.FromSlash(pth)
+	if filepath.IsAbs(pth) {
+		return pth
+	}
+	return filepath.Join(dir, pth)
+}
+
+// check validates the target.
+func (t *buildTarget) check() error {
+	if t.Input == "" {
+		return errors.New("missing input")
+	}
+	if t.Output == "" {
+		return errors.New("missing output")
+	}
+	switch t.Format {
+	case "", "json", "yaml", "canonical":
+	default:
+		return fmt.Errorf("unsupported format %q", t.Format)
+	}
+	switch t.GroupBy {
+	case "", "tag", "path":
+	default:
+		return fmt.Errorf("invalid group-by %q (expected: tag or path)", t.GroupBy)
+	}
+	for _, tr := range t.Transforms {
+		if _, ok := targetTransforms[tr]; !ok {
+			return fmt.Errorf("unknown transform %q", tr)
+		}
+	}
+	return nil
+}
+
+// build builds the target. Documents are loaded through cache.
+//
+// defs holds the interpolation settings of the command line (-interpolate and
+// -D): its variables take precedence over the variables of the target.
+func (t *buildTarget) build(cache docCache, defs *loader) error {
+	ld := loader{cache: cache, interpolate: defs.interpolate}
+	for name, value := range t.Variables {
+		if err := ld.Define(name + "=" + value); err != nil {
+			return err
+		}
+	}
+	for name, value := range defs.vars {
+		if err := ld.Define(name + "=" + value); err != nil {
+			return err
+		}
+	}
+
+	opts := options{filters: t.Filters}
+	for _, tr := range t.Transforms {
+		targetTransforms[tr](&opts)
+	}
+
+	format := t.Format
+	if format == "" {
+		format = outputFormat(t.Output)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.Output), 0o755); err != nil {
+		return err
+	}
+	if t.GroupBy != "" {
+		return processFile(t.Input, &ld, func(doc interface{}) error {
+			return writeGroups(doc, t.GroupBy, t.Output, format, false)
+		}, &opts)
+	}
+
+	var buf bytes.Buffer
+	encode, err := newEncoder(&buf, format, false)
+	if err != nil {
+		return err
+	}
+	if err = processFile(t.Input, &ld, encode, &opts); err != nil {
+		return err
+	}
+	return writeFile(t.Output, buf.Bytes())
+}
+
+// buildMain runs the build subcommand with the arguments that follow it.
+func buildMain(args []string) (int, error) {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	config := flags.String("config", configName, "project config `file`")
+	var defs loader
+	flags.BoolVar(&defs.interpolate, "interpolate", false, "interpolate ${VAR} in string values from -D, the variables of the target and environment variables")
+	flags.Func("D", "define a `name=value` variable for ${name} interpolation, overriding the variables of the targets (repeatable, implies -interpolate)", defs.Define)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s build [-config <file>] [-interpolate] [-D <name>=<value>]... [<target>...]\nOptions:\n", os.Args[0])
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	flags.Parse(args)
+
+	targets, err := loadConfig(*config)
+	if err != nil {
+		return 2, err
+	}
+	if flags.NArg() > 0 {
+		selected := make([]*buildTarget, 0, flags.NArg())
+		for _, name := range flags.Args() {
+			i := slices.IndexFunc(targets, func(t *buildTarget) bool {
+				return t.Name == name
+			})
+			if i < 0 {
+				return 2, fmt.Errorf("%s: unknown target %q", *config, name)
+			}
+			selected = append(selected, targets[i])
+		}
+		targets = selected
+	}
+
+	// Documents are shared by targets
+	cache := make(docCache)
+	for _, t := range targets {
+		if err = t.build(cache, &defs); err != nil {
+			return 0, fmt.Errorf("%s: %v", t.Name, err)
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		pth := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(pth), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pth, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		configName: `targets:
+  public:
+    input: api/openapi.yaml
+    output: dist/public.json
+    variables:
+      VERSION: 1.2
+  internal:
+    input: api/openapi.yaml
+    output: dist/internal.yaml
+    transforms: [dereference]
+`,
+		"bad.yaml": `targets:
+  public:
+    input: api/openapi.yaml
+    outptu: dist/public.json
+`,
+		"transform.yaml": `targets:
+  public:
+    input: api/openapi.yaml
+    output: dist/public.json
+    transforms: [minify]
+`,
+	})
+
+	targets, err := loadConfig(filepath.Join(dir, configName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 {
+		t.Fatalf("%d targets", len(targets))
+	}
+	assertString(t, targets[0].Name, "public")
+	assertString(t, targets[1].Name, "internal")
+	assertString(t, targets[0].Input, filepath.Join(dir, "api", "openapi.yaml"))
+	assertString(t, targets[0].Variables["VERSION"], "1.2")
+
+	// Absolute paths and URLs are kept
+	out := filepath.Join(t.TempDir(), "public.json")
+	writeFiles(t, dir, map[string]string{
+		"abs.yaml": `targets:
+  public:
+    input: https://api.example.com/openapi.yaml
+    output: '` + filepath.ToSlash(out) + `'
+`,
+	})
+	if targets, err = loadConfig(filepath.Join(dir, "abs.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, targets[0].Input, "https://api.example.com/openapi.yaml")
+	assertString(t, targets[0].Output, out)
+
+	_, err = loadConfig(filepath.Join(dir, "bad.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "outptu") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	_, err = loadConfig(filepath.Join(dir, "transform.yaml"))
+	if err == nil || !strings.Contains(err.Error(), `unknown transform "minify"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		configName: `targets:
+  public:
+    input: api/openapi.yaml
+    output: dist/public.json
+    format: canonical
+    filters:
+      exclude-tags: [internal]
+    variables:
+      AUDIENCE: Public
+  internal:
+    input: api/openapi.yaml
+    output: dist/internal.yaml
+    variables:
+      AUDIENCE: Internal
+`,
+		"api/openapi.yaml": `openapi: 3.1.0
+info:
+  title: ${AUDIENCE} API
+  version: "1.0"
+paths:
+  /pets:
+    get:
+      responses:
+        "200":
+          $ref: common.yaml#/components/responses/Pets
+  /admin:
+    post:
+      tags: [internal]
+      responses:
+        "204":
+          description: Done
+`,
+		"api/common.yaml": `components:
+  responses:
+    Pets:
+      description: Pets
+`,
+	})
+
+	targets, err := loadConfig(filepath.Join(dir, configName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := make(docCache)
+	for _, target := range targets {
+		if err = target.build(cache, &loader{}); err != nil {
+			t.Fatalf("%s: %v", target.Name, err)
+		}
+	}
+	if len(cache) != 2 {
+		t.Errorf("%d documents in cache", len(cache))
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "dist", "public.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, string(b), `{"components":{"responses":{"Pets":{"description":"Pets"}}},"info":{"title":"Public API","version":"1.0"},"openapi":"3.1.0","paths":{"/pets":{"get":{"responses":{"200":{"$ref":"#/components/responses/Pets"}}}}}}`)
+
+	b, err = os.ReadFile(filepath.Join(dir, "dist", "internal.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(b); !strings.Contains(s, "title: Internal API\n") || !strings.Contains(s, "/admin:") {
+		t.Errorf("unexpected output:\n%s", s)
+	}
+}
+
+func TestBuildInterpolate(t *testing.T) {
+	t.Setenv("OPENAPI_TEST_SERVER", "https://api.example.com")
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		configName: `targets:
+  plain:
+    input: api/openapi.yaml
+    output: dist/plain.json
+    format: canonical
+  vars:
+    input: api/openapi.yaml
+    output: dist/vars.json
+    format: canonical
+    variables:
+      AUDIENCE: Config
+`,
+		"api/openapi.yaml": `openapi: 3.1.0
+info:
+  title: ${AUDIENCE:-Default} API
+  version: "1.0"
+servers:
+- url: ${OPENAPI_TEST_SERVER}
+paths: {}
+`,
+	})
+	targets, err := loadConfig(filepath.Join(dir, configName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, vars := targets[0], targets[1]
+
+	build := func(target *buildTarget, defs *loader, expected string) {
+		t.Helper()
+		if err := target.build(make(docCache), defs); err != nil {
+			t.Fatalf("%s: %v", target.Name, err)
+		}
+		b, err := os.ReadFile(target.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertString(t, string(b), `{"info":{"title":"`+expected+` API","version":"1.0"},"openapi":"3.1.0","paths":{},"servers":[{"url":"https://api.example.com"}]}`)
+	}
+
+	// -interpolate alone: environment variables
+	build(plain, &loader{interpolate: true}, "Default")
+
+	// -D alone, without variables in the config file
+	var defs loader
+	if err = defs.Define("AUDIENCE=Cli"); err != nil {
+		t.Fatal(err)
+	}
+	build(plain, &defs, "Cli")
+
+	// -D overrides the variables of the target
+	build(vars, &loader{}, "Config")
+	build(vars, &defs, "Cli")
+}
+
+func TestBuildHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	out := filepath.Join(t.TempDir(), "api.json")
+	writeFiles(t, dir, map[string]string{
+		configName: `targets:
+  remote:
+    input: ` + srv.URL + `/10-ref-ext/input.yml
+    output: '` + filepath.ToSlash(out) + `'
+    format: canonical
+`,
+	})
+	targets, err := loadConfig(filepath.Join(dir, configName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = targets[0].build(make(docCache), &loader{}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, string(b), `{"info":{"title":"Test","version":"0.0.0"},"paths":{"/":{"get":{"responses":{"404":{"description":"Not found."}}}}},"swagger":"2.0"}`)
+}
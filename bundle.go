@@ -0,0 +1,192 @@
+package main
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/dolmen-go/jsonptr"
+)
+
+// bundler hoists the targets of external $ref into the components of the
+// root document (see [BundleRefs]).
+type bundler struct {
+	root      *object
+	swagger   bool // Swagger 2.0: /definitions, /parameters, /responses
+	pathItems bool // OpenAPI 3.1+: /components/pathItems
+
+	refs    map[loc]string // external target -> pointer of the component
+	done    map[loc]bool   // location of the $ref already rewritten
+	hoisted []hoistedComponent
+}
+
+type hoistedComponent struct {
+	ptr  string // for example /components/schemas/Pet
+	data interface{}
+	from loc // location of the target
+}
+
+func newBundler(root *object) *bundler {
+	b := bundler{
+		root: root,
+		refs: make(map[loc]string),
+		done: make(map[loc]bool),
+	}
+	_, b.swagger = root.Get("swagger")
+	if version, ok := stringProp(root, "openapi"); ok {
+		b.pathItems = !strings.HasPrefix(version, "3.0")
+	}
+	return &b
+}
+
+// componentKind returns the kind of component (as in OpenAPI 3 /components)
+// expected at ptr, or "" if unknown.
+func componentKind(ptr jsonptr.Pointer) string {
+	n := len(ptr)
+	switch {
+	case n == 0:
+		return ""
+	case n >= 3 && ptr[n-3] == "components":
+		return ptr[n-2]
+	case n == 2 && (ptr[0] == "definitions" || ptr[0] == "parameters" || ptr[0] == "responses"):
+		// Swagger 2.0
+		if ptr[0] == "definitions" {
+			return "schemas"
+		}
+		return ptr[0]
+	}
+
+	switch ptr[n-1] {
+	case "schema", "items", "not", "additionalProperties", "additionalItems",
+		"contains", "propertyNames", "if", "then", "else":
+		return "schemas"
+	case "requestBody":
+		return "requestBodies"
+	}
+	if n < 2 {
+		return ""
+	}
+	switch ptr[n-2] {
+	case "properties", "patternProperties", "dependentSchemas", "$defs", "definitions",
+		"allOf", "anyOf", "oneOf", "prefixItems":
+		return "schemas"
+	case "parameters", "responses", "headers", "examples", "links", "callbacks":
+		return ptr[n-2]
+	case "paths":
+		if n == 2 {
+			return "pathItems"
+		}
+	}
+	return ""
+}
+
+// section returns the pointer of the section of the root document where
+// a component of the given kind is hoisted, or "" if the kind can't be hoisted.
+func (b *bundler) section(kind string) string {
+	if b.swagger {
+		switch kind {
+		case "schemas":
+			return "/definitions"
+		case "parameters", "responses":
+			return "/" + kind
+		}
+		return ""
+	}
+	switch kind {
+	case "schemas", "responses", "parameters", "examples", "requestBodies",
+		"headers", "securitySchemes", "links", "callbacks":
+		return "/components/" + kind
+	case "pathItems":
+		if b.pathItems {
+			return "/components/pathItems"
+		}
+	}
+	return ""
+}
+
+// componentName returns a name for the component hoisted from target: the
+// last part of the pointer, or the name of the file. Characters not allowed
+// in component names are replaced by '_'.
+func componentName(target loc) string {
+	name := target.Ptr[strings.LastIndexByte(target.Ptr, '/')+1:]
+	name, _ = jsonptr.UnescapeString(name)
+	if name == "" || strings.Trim(name, "0123456789") == "" {
+		base := path.Base(target.Path)
+		if i := strings.IndexByte(base, '.'); i > 0 {
+			base = base[:i]
+		}
+		if name == "" {
+			name = base
+		} else {
+			name = base + "_" + name
+		}
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+// hoist registers target (the node pointed by the $ref at refLoc) as a
+// component of the root document and returns its pointer. ok is false if the
+// kind of component can't be determined.
+func (b *bundler) hoist(refLoc *loc, target *node, rootPath string) (ptr string, ok bool) {
+	if ptr, ok = b.refs[target.loc]; ok {
+		return ptr, true
+	}
+
+	refPtr, _ := jsonptr.Parse(refLoc.Ptr)
+	targetPtr, _ := jsonptr.Parse(target.loc.Ptr)
+	kind := componentKind(refPtr)
+	if kind == "" {
+		kind = componentKind(targetPtr)
+	}
+	section := b.section(kind)
+	if section == "" {
+		return "", false
+	}
+
+	if refLoc.Path == rootPath && len(refPtr) > 0 && jsonptr.Pointer(refPtr[:len(refPtr)-1]).String() == section {
+		// The $ref is a component of the root document: replace it with the target
+		ptr = refLoc.Ptr
+	} else {
+		name := componentName(target.loc)
+		existing, _ := getPointer(b.root, section)
+		components, _ := existing.(*object)
+		ptr = section + "/" + jsonptr.EscapeString(name)
+		for i := 2; b.used(components, ptr); i++ {
+			ptr = section + "/" + jsonptr.EscapeString(name+strconv.Itoa(i))
+		}
+	}
+	b.refs[target.loc] = ptr
+	b.hoisted = append(b.hoisted, hoistedComponent{ptr, target.data, target.loc})
+	return ptr, true
+}
+
+// used returns true if ptr is an existing component or the pointer of an
+// already hoisted component.
+func (b *bundler) used(components *object, ptr string) bool {
+	if _, exists := components.Get(ptr[strings.LastIndexByte(ptr, '/')+1:]); exists {
+		return true
+	}
+	for _, h := range b.hoisted {
+		if h.ptr == ptr {
+			return true
+		}
+	}
+	return false
+}
+
+// inject sets the hoisted components into the root document.
+func (b *bundler) inject() error {
+	for _, h := range b.hoisted {
+		if err := setCreate(b.root, jsonptr.MustParse(h.ptr), h.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
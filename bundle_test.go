@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dolmen-go/jsonptr"
+)
+
+func TestComponentKind(t *testing.T) {
+	for ptr, kind := range map[string]string{
+		"":                                "",
+		"/info":                           "",
+		"/paths/~1pets":                   "pathItems",
+		"/paths/~1pets/get/parameters/0":  "parameters",
+		"/paths/~1pets/get/responses/200": "responses",
+		"/paths/~1pets/get/requestBody":   "requestBodies",
+		"/paths/~1pets/get/responses/200/content/application~1json/schema":     "schemas",
+		"/paths/~1pets/get/responses/200/content/application~1json/examples/x": "examples",
+		"/paths/~1pets/get/responses/200/headers/X-Rate":                       "headers",
+		"/components/schemas/Pet":                                              "schemas",
+		"/components/schemas/Pet/properties/parameters":                        "schemas",
+		"/components/schemas/Pet/properties/tags/items":                        "schemas",
+		"/components/schemas/Pet/allOf/1":                                      "schemas",
+		"/components/securitySchemes/oauth":                                    "securitySchemes",
+		"/definitions/Pet":                                                     "schemas",
+		"/parameters/limit":                                                    "parameters",
+		"/anything/Pet":                                                        "",
+	} {
+		assertString(t, componentKind(jsonptr.MustParse(ptr)), kind)
+	}
+}
+
+func TestComponentName(t *testing.T) {
+	for _, tc := range []struct {
+		target loc
+		name   string
+	}{
+		{loc{"/api/pet.yaml", ""}, "pet"},
+		{loc{"/api/pet.schema.json", ""}, "pet"},
+		{loc{"/api/common.yaml", "/schemas/Error"}, "Error"},
+		{loc{"/api/common.yaml", "/schemas/Error~1Detail"}, "Error_Detail"},
+		{loc{"/api/list.yaml", "/items/0"}, "list_0"},
+		{loc{"/api/x.yaml", "/Café"}, "Caf_"},
+	} {
+		assertString(t, componentName(tc.target), tc.name)
+	}
+}
+
+func TestBundleRefs(t *testing.T) {
+	expected, err := loadFile("testdata/bundle/result.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out interface{}
+	err = processFile("testdata/bundle/input.yml", &loader{}, func(result interface{}) error {
+		out = result
+		return nil
+	}, &options{bundle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalJSON(out, expected) {
+		b, _ := json.MarshalIndent(out, "", "  ")
+		t.Errorf("output doesn't match:\n%s", b)
+	}
+}
+
+func TestBundleRefsSwagger(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"input.yml": `---
+swagger: "2.0"
+info:
+  title: API
+  version: "1.0"
+paths:
+  /pets:
+    parameters:
+    - $ref: common.yml#/params/limit
+    get:
+      responses:
+        200:
+          description: OK
+          schema:
+            $ref: common.yml#/Pet
+        default:
+          $ref: common.yml#/errors/default
+definitions:
+  Pet:
+    type: string
+`,
+		"common.yml": `---
+params:
+  limit:
+    name: limit
+    in: query
+    type: integer
+Pet:
+  type: object
+errors:
+  default:
+    description: Error
+    schema:
+      $ref: "#/Pet"
+`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out interface{}
+	err := processFile(filepath.Join(dir, "input.yml"), &loader{}, func(result interface{}) error {
+		out = result
+		return nil
+	}, &options{bundle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := appendJSON(nil, out)
+	assertString(t, string(b), `{"swagger":"2.0","info":{"title":"API","version":"1.0"},`+
+		`"paths":{"/pets":{"parameters":[{"$ref":"#/parameters/limit"}],"get":{"responses":{"200":{"description":"OK","schema":{"$ref":"#/definitions/Pet2"}},"default":{"$ref":"#/responses/default"}}}}},`+
+		`"definitions":{"Pet2":{"type":"object"}},`+
+		`"responses":{"default":{"description":"Error","schema":{"$ref":"#/definitions/Pet2"}}},`+
+		`"parameters":{"limit":{"name":"limit","in":"query","type":"integer"}}}`)
+}
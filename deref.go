@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dolmen-go/jsonptr"
+)
+
+// Dereference replaces every $ref (which must be internal links, as ensured by
+// ExpandRefs) with a copy of its target.
+//
+// A $ref that links to one of its ancestors (through the targets of the
+// $ref followed so far) is circular. It is kept if keepCycles is true, else
+// this is an error.
+//
+// The copies are recorded in src (which may be nil).
+func Dereference(rdoc *interface{}, keepCycles bool, src *sources) error {
+	d := dereferencer{
+		// Targets are copied from the original document, not from the
+		// document being dereferenced
+		root:       deepCopy(*rdoc),
+		keepCycles: keepCycles,
+		src:        src,
+	}
+	return d.walk(*rdoc, func(v interface{}) { *rdoc = v }, nil, "")
+}
+
+type dereferencer struct {
+	root       interface{} // original document
+	keepCycles bool
+	src        *sources
+	chain      []string // origins of the $ref followed
+}
+
+// walk dereferences v (set with set). ptr is the location of v in the output
+// and origin is its location in the document before dereferencing.
+func (d *dereferencer) walk(v interface{}, set setter, ptr jsonptr.Pointer, origin string) error {
+	switch v := v.(type) {
+	case *object:
+		if ref, isRef := stringProp(v, "$ref"); isRef && !skipRef(ptr) {
+			return d.deref(v, ref, set, ptr, origin)
+		}
+		for _, k := range v.SortedKeys() {
+			item, _ := v.Get(k)
+			err := d.walk(item, func(data interface{}) {
+				v.Set(k, data)
+			}, append(ptr[:len(ptr):len(ptr)], k), origin+"/"+jsonptr.EscapeString(k))
+			if err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			err := d.walk(item, func(data interface{}) {
+				v[i] = data
+			}, append(ptr[:len(ptr):len(ptr)], fmt.Sprint(i)), fmt.Sprintf("%s/%d", origin, i))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *dereferencer) deref(obj *object, ref string, set setter, ptr jsonptr.Pointer, origin string) error {
+	if ref == "" || ref[0] != '#' {
+		return fmt.Errorf("%s: unexpected $ref %q", ptr, ref)
+	}
+	link := ref[1:]
+
+	for _, o := range append(d.chain, origin) {
+		if o == link || strings.HasPrefix(o, link+"/") {
+			if d.keepCycles {
+				return nil
+			}
+			return fmt.Errorf("%s: circular $ref to %q", ptr, link)
+		}
+	}
+
+	target, err := getPointer(d.root, link)
+	if err != nil {
+		return fmt.Errorf("%s: %q: %v", ptr, link, err)
+	}
+	target = deepCopy(target)
+	var overrides []string
+	if targetObj, isObj := target.(*object); isObj {
+		// OpenAPI 3.1: summary and description along $ref override those of the target
+		for _, k := range []string{"summary", "description"} {
+			if s, ok := stringProp(obj, k); ok {
+				targetObj.Set(k, s)
+				overrides = append(overrides, k)
+			}
+		}
+	}
+	set(target)
+	d.src.copyPtr(ptr.String(), link, overrides...)
+
+	d.chain = append(d.chain, origin)
+	err = d.walk(target, set, ptr, link)
+	d.chain = d.chain[:len(d.chain)-1]
+	return err
+}
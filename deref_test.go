@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDereference(t *testing.T) {
+	const spec = `{
+		"openapi": "3.1.0",
+		"paths": {
+			"/n": {
+				"get": {
+					"parameters": [{"$ref": "#/components/parameters/id"}],
+					"responses": {"200": {"$ref": "#/components/responses/ok", "description": "Overridden"}}
+				}
+			}
+		},
+		"components": {
+			"parameters": {"id": {"name": "id", "in": "query", "schema": {"$ref": "#/components/schemas/Id"}}},
+			"responses": {"ok": {"description": "OK", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Node"}}}}},
+			"schemas": {
+				"Id": {"type": "string"},
+				"Node": {"type": "object", "properties": {"id": {"$ref": "#/components/schemas/Id"}, "children": {"$ref": "#/components/schemas/Children"}}},
+				"Children": {"type": "array", "items": {"$ref": "#/components/schemas/Node"}},
+				"Props": {"properties": {"$ref": {"type": "string"}}}
+			}
+		}
+	}`
+
+	load := func() interface{} {
+		doc, err := decodeJSON([]byte(spec))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc
+	}
+
+	doc := load()
+	err := Dereference(&doc, false, nil)
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	t.Log(err)
+	if !strings.Contains(err.Error(), `circular $ref to "/components/schemas/`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	doc = load()
+	if err = Dereference(&doc, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = CleanUnused(&doc); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := appendJSON(nil, doc)
+	assertString(t, string(b), `{"openapi":"3.1.0","paths":{"/n":{"get":{`+
+		`"parameters":[{"name":"id","in":"query","schema":{"type":"string"}}],`+
+		`"responses":{"200":{"description":"Overridden","content":{"application/json":{"schema":{"type":"object","properties":{"id":{"type":"string"},"children":{"type":"array","items":{"$ref":"#/components/schemas/Node"}}}}}}}}}}},`+
+		`"components":{"schemas":{"Node":{"type":"object","properties":{"id":{"type":"string"},"children":{"type":"array","items":{"$ref":"#/components/schemas/Node"}}}}}}}`)
+
+	doc = toObjects(map[string]interface{}{"a": map[string]interface{}{"$ref": "other.yml#/a"}})
+	if err = Dereference(&doc, true, nil); err == nil {
+		t.Error("error expected")
+	}
+}
+
+func TestProcessDereference(t *testing.T) {
+	var out interface{}
+	err := processFile("testdata/bundle/input.yml", &loader{}, func(result interface{}) error {
+		out = result
+		return nil
+	}, &options{bundle: true, dereference: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := appendJSON(nil, out)
+	if strings.Contains(string(b), "$ref") || strings.Contains(string(b), "components") {
+		t.Errorf("$ref or components left: %s", b)
+	}
+}
+
+func TestProcessDereferenceRecursive(t *testing.T) {
+	fsys := fstest.MapFS{
+		"api.yaml": {Data: []byte(`openapi: 3.1.0
+info: {title: Test, version: "1.0"}
+paths:
+  /nodes:
+    get:
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema: {$ref: "#/components/schemas/Node"}
+  /trees:
+    get:
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema: {$ref: "tree.yaml#/components/schemas/Tree"}
+components:
+  schemas:
+    Node:
+      type: object
+      properties:
+        next: {$ref: "#/components/schemas/Node"}
+`)},
+		"tree.yaml": {Data: []byte(`components:
+  schemas:
+    Tree:
+      type: array
+      items: {$ref: "#/components/schemas/Tree"}
+`)},
+	}
+
+	var out interface{}
+	encode := func(result interface{}) error {
+		out = result
+		return nil
+	}
+
+	// Without dereferencing, direct recursion is allowed
+	err := processFile("api.yaml", &loader{fsys: fsys}, encode, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = processFile("api.yaml", &loader{fsys: fsys}, encode, &options{dereference: true})
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	if !strings.Contains(err.Error(), `circular $ref to "/components/schemas/`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err = processFile("api.yaml", &loader{fsys: fsys}, encode, &options{dereference: true, keepCycles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := appendJSON(nil, out)
+	assertString(t, string(b), `{"openapi":"3.1.0","info":{"title":"Test","version":"1.0"},"paths":{`+
+		`"/nodes":{"get":{"responses":{"200":{"description":"OK","content":{"application/json":{"schema":{"type":"object","properties":{"next":{"$ref":"#/components/schemas/Node"}}}}}}}}},`+
+		`"/trees":{"get":{"responses":{"200":{"description":"OK","content":{"application/json":{"schema":{"type":"array","items":{"$ref":"#/components/schemas/Tree"}}}}}}}}},`+
+		`"components":{"schemas":{"Node":{"type":"object","properties":{"next":{"$ref":"#/components/schemas/Node"}}},"Tree":{"type":"array","items":{"$ref":"#/components/schemas/Tree"}}}}}`)
+}
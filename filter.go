@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// filters select the operations of a spec (see [Filter]).
+type filters struct {
+	Tags        []string `yaml:"tags"`         // keep only operations having one of these tags
+	ExcludeTags []string `yaml:"exclude-tags"` // remove operations having one of these tags
+	Paths       []string `yaml:"paths"`        // keep only paths starting with one of these prefixes
+}
+
+// operationMethods are the keys of a path item which are operations.
+var operationMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// matchPath returns true if pth is the path prefix or a path below it.
+func matchPath(pth string, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return pth == prefix || strings.HasPrefix(pth, prefix+"/")
+}
+
+// keepOperation returns true if an operation with the given tags is selected.
+func (f *filters) keepOperation(tags []string) bool {
+	if len(f.Tags) > 0 && !slices.ContainsFunc(tags, func(tag string) bool {
+		return slices.Contains(f.Tags, tag)
+	}) {
+		return false
+	}
+	return !slices.ContainsFunc(tags, func(tag string) bool {
+		return slices.Contains(f.ExcludeTags, tag)
+	})
+}
+
+// keepTag returns true if the declaration of tag (in /tags) is kept.
+func (f *filters) keepTag(tag string) bool {
+	return (len(f.Tags) == 0 || slices.Contains(f.Tags, tag)) && !slices.Contains(f.ExcludeTags, tag)
+}
+
+// Filter removes from the document the operations (in /paths and /webhooks)
+// which are not selected by f. Path items left without operations are
+// removed, as well as the declarations of the tags excluded by f (and /tags
+// if none is left).
+//
+// Components which are not used anymore are left for [CleanUnused].
+func Filter(rdoc *interface{}, f *filters) error {
+	root, isObj := (*rdoc).(*object)
+	if !isObj {
+		return errors.New("root is not an object")
+	}
+
+	if paths, ok := objectProp(root, "paths"); ok {
+		for _, pth := range paths.Keys() {
+			if len(f.Paths) > 0 && !slices.ContainsFunc(f.Paths, func(prefix string) bool {
+				return matchPath(pth, prefix)
+			}) {
+				paths.Delete(pth)
+				continue
+			}
+			f.filterPathItem(paths, pth)
+		}
+	}
+	if webhooks, ok := objectProp(root, "webhooks"); ok {
+		for _, name := range webhooks.Keys() {
+			f.filterPathItem(webhooks, name)
+		}
+	}
+
+	if tags, ok := arrayProp(root, "tags"); ok && len(tags) > 0 {
+		tags = slices.DeleteFunc(tags, func(tag interface{}) bool {
+			obj, isObj := tag.(*object)
+			if !isObj {
+				return false
+			}
+			name, _ := stringProp(obj, "name")
+			return !f.keepTag(name)
+		})
+		if len(tags) == 0 {
+			root.Delete("tags")
+		} else {
+			root.Set("tags", tags)
+		}
+	}
+	return nil
+}
+
+// filterPathItem removes the operations of the path item parent[key] which
+// are not selected, and the path item itself if no operation is left.
+func (f *filters) filterPathItem(parent *object, key string) {
+	item, isObj := objectProp(parent, key)
+	if !isObj {
+		return
+	}
+	if _, isRef := item.Get("$ref"); isRef {
+		return
+	}
+	hadOperations := false
+	for _, method := range operationMethods {
+		op, isObj := objectProp(item, method)
+		if !isObj {
+			continue
+		}
+		hadOperations = true
+		var tags []string
+		if arr, ok := arrayProp(op, "tags"); ok {
+			for _, tag := range iterArray[string](arr) {
+				tags = append(tags, tag)
+			}
+		}
+		if !f.keepOperation(tags) {
+			item.Delete(method)
+		}
+	}
+	if hadOperations && !slices.ContainsFunc(operationMethods, func(method string) bool {
+		_, exists := item.Get(method)
+		return exists
+	}) {
+		parent.Delete(key)
+	}
+}
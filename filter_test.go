@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestFilter(t *testing.T) {
+	for _, tc := range []struct {
+		f        filters
+		expected string
+	}{
+		{filters{}, `{"tags":[{"name":"pets"},{"name":"internal"}],"paths":{"/pets":{"get":{"tags":["pets"]},"post":{"tags":["pets","internal"]}},"/pets/{id}":{"get":{"tags":["pets"]}},"/petshop":{"get":{}},"/admin":{"delete":{"tags":["internal"]}}}}`},
+		{filters{ExcludeTags: []string{"internal"}}, `{"tags":[{"name":"pets"}],"paths":{"/pets":{"get":{"tags":["pets"]}},"/pets/{id}":{"get":{"tags":["pets"]}},"/petshop":{"get":{}}}}`},
+		{filters{Tags: []string{"internal"}}, `{"tags":[{"name":"internal"}],"paths":{"/pets":{"post":{"tags":["pets","internal"]}},"/admin":{"delete":{"tags":["internal"]}}}}`},
+		{filters{Paths: []string{"/pets/"}}, `{"tags":[{"name":"pets"},{"name":"internal"}],"paths":{"/pets":{"get":{"tags":["pets"]},"post":{"tags":["pets","internal"]}},"/pets/{id}":{"get":{"tags":["pets"]}}}}`},
+	} {
+		doc, err := decodeJSON([]byte(`{"tags":[{"name":"pets"},{"name":"internal"}],"paths":{"/pets":{"get":{"tags":["pets"]},"post":{"tags":["pets","internal"]}},"/pets/{id}":{"get":{"tags":["pets"]}},"/petshop":{"get":{}},"/admin":{"delete":{"tags":["internal"]}}}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rdoc interface{} = doc
+		if err = Filter(&rdoc, &tc.f); err != nil {
+			t.Fatal(err)
+		}
+		b, _ := appendJSON(nil, rdoc)
+		assertString(t, string(b), tc.expected)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// gitPrefix is the prefix of links to a file at a revision of the local git repository:
+//
+//	git:<revision>:<path>
+const gitPrefix = "git:"
+
+var errGitFS = errors.New("git links are supported only with the file system of the OS")
+
+// isGit returns true if pth is a link to a file at a git revision.
+func isGit(pth string) bool {
+	return strings.HasPrefix(pth, gitPrefix)
+}
+
+// splitGit splits "git:<revision>:<path>".
+func splitGit(pth string) (rev string, file string, err error) {
+	rev, file, ok := strings.Cut(pth[len(gitPrefix):], ":")
+	if !ok || rev == "" || file == "" {
+		return "", "", fmt.Errorf("%q: git:<revision>:<path> expected", pth)
+	}
+	return rev, file, nil
+}
+
+// resolveGitLocation resolves pth relative to base when one of them is a git location.
+//
+// The path of a git link is relative to the referencing document, and relative
+// links inside a document loaded from git stay at the same revision.
+func resolveGitLocation(base string, pth string) (string, error) {
+	var rev string
+	if isGit(base) {
+		var err error
+		rev, base, err = splitGit(base)
+		if err != nil {
+			return "", err
+		}
+	} else if isRemote(base) {
+		return "", fmt.Errorf("%q: git link not allowed from remote document", pth)
+	}
+	if isGit(pth) {
+		var err error
+		rev, pth, err = splitGit(pth)
+		if err != nil {
+			return "", err
+		}
+	}
+	target, err := resolveLocation(base, pth)
+	if err != nil || isRemote(target) {
+		return target, err
+	}
+	return gitPrefix + rev + ":" + target, nil
+}
+
+// gitToplevel returns the toplevel directory of the git repository that
+// contains dir (an existing directory of the OS). The toplevel is found once
+// and kept in cache.
+func (ld *loader) gitToplevel(dir string) (string, error) {
+	if top, ok := ld.gitToplevels[dir]; ok {
+		return top, nil
+	}
+	cmd := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = errors.New(msg)
+		}
+		return "", err
+	}
+	top := filepath.FromSlash(strings.TrimSpace(string(out)))
+	if ld.gitToplevels == nil {
+		ld.gitToplevels = make(map[string]string)
+	}
+	ld.gitToplevels[dir] = top
+	return top, nil
+}
+
+// gitLocate returns the toplevel directory of the git repository that
+// contains file (an absolute path, slash separated) and the path of file
+// relative to it (slash separated).
+//
+// As file is read at a revision, it (and its directories) may not exist in
+// the worktree: the repository is found from the nearest existing directory.
+func (ld *loader) gitLocate(file string) (top string, rel string, err error) {
+	dir, rest := path.Split(file)
+	dir = path.Clean(dir)
+	for {
+		if fi, err := os.Stat(filepath.FromSlash(dir)); err == nil && fi.IsDir() {
+			break
+		}
+		parent := path.Dir(dir)
+		if parent == dir {
+			return "", "", errors.New("not in a git repository")
+		}
+		rest = path.Join(path.Base(dir), rest)
+		dir = parent
+	}
+	// The toplevel given by git has symbolic links resolved
+	realDir, err := filepath.EvalSymlinks(filepath.FromSlash(dir))
+	if err != nil {
+		return "", "", err
+	}
+	if top, err = ld.gitToplevel(realDir); err != nil {
+		return "", "", err
+	}
+	rel, err = filepath.Rel(top, filepath.Join(realDir, filepath.FromSlash(rest)))
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", "", errors.New("outside of the git repository")
+	}
+	return top, filepath.ToSlash(rel), nil
+}
+
+// loadGitBytes reads the file at a revision of the git repository that
+// contains it, without a checkout.
+//
+// pth is "git:<revision>:<path>" where <path> is absolute (slash separated).
+func (ld *loader) loadGitBytes(pth string) ([]byte, error) {
+	rev, file, err := splitGit(pth)
+	if err != nil {
+		return nil, err
+	}
+	top, rel, err := ld.gitLocate(file)
+	if err != nil {
+		return nil, fmt.Errorf("revision %q, path %q: %v", rev, file, err)
+	}
+	cmd := exec.Command("git", "-C", top, "cat-file", "blob", rev+":"+rel)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	data, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = errors.New(msg)
+		}
+		return nil, fmt.Errorf("revision %q, path %q: %v", rev, file, err)
+	}
+	return data, nil
+}
+
+// loadGit loads a document at a git revision. pth may have a "?doc=N" suffix.
+func (ld *loader) loadGit(pth string, pos positions) (*object, error) {
+	pth, doc, err := splitDocSelector(pth)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ld.loadGitBytes(pth)
+	if err != nil {
+		return nil, err
+	}
+	return loadNamed(bytes.NewReader(data), pth, doc, pos)
+}
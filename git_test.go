@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandRefsGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		pth := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(pth), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pth, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+	write("api/info.yml", "info:\n  $inline: title.yml#/info\n  version: 1.0.0\n")
+	write("api/title.yml", "info:\n  title: Old\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "v1")
+	git("tag", "v1")
+	write("api/info.yml", "info:\n  $inline: title.yml#/info\n  version: 2.0.0\n")
+	write("api/title.yml", "info:\n  title: New\n")
+	write("spec/input.yml", `swagger: "2.0"
+info:
+  $ref: git:v1:../api/info.yml#/info
+x-current-title:
+  $inline: ../api/title.yml#/info/title
+paths: {}
+`)
+
+	var out interface{}
+	err := processFile(filepath.Join(dir, "spec/input.yml"), &loader{}, func(result interface{}) error {
+		out = result
+		return nil
+	}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"swagger": "2.0",
+		"info": map[string]interface{}{
+			"title":   "Old",
+			"version": "1.0.0",
+		},
+		"x-current-title": "New",
+		"paths":           map[string]interface{}{},
+	}
+	if !equalJSON(out, expected) {
+		t.Errorf("output doesn't match: %#v", out)
+	}
+
+	// The directory of the file has been moved since the revision
+	git("mv", "api", "common")
+	git("commit", "-q", "-m", "move")
+	expected["x-current-title"] = "Old"
+	write("spec/input.yml", `swagger: "2.0"
+info:
+  $ref: git:v1:../api/info.yml#/info
+x-current-title:
+  $inline: git:v1:../api/title.yml#/info/title
+paths: {}
+`)
+	out = nil
+	err = processFile(filepath.Join(dir, "spec/input.yml"), &loader{}, func(result interface{}) error {
+		out = result
+		return nil
+	}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalJSON(out, expected) {
+		t.Errorf("output doesn't match: %#v", out)
+	}
+
+	write("spec/input.yml", `swagger: "2.0"
+info:
+  $ref: git:v0:../api/info.yml#/info
+`)
+	err = processFile(filepath.Join(dir, "spec/input.yml"), &loader{}, func(interface{}) error { return nil }, &options{})
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	t.Log(err)
+	if msg := err.Error(); !strings.Contains(msg, `"v0"`) || !strings.Contains(msg, "api/info.yml") {
+		t.Errorf("revision and path expected in error: %v", err)
+	}
+}
@@ -4,6 +4,5 @@ go 1.23
 
 require (
 	github.com/dolmen-go/jsonptr v0.0.0-20220904212016-e3f38a361346
-	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// specGroup is a partial spec (see [Groups]).
+type specGroup struct {
+	name string
+	doc  *object
+}
+
+// Groups returns the partial specs of the processed document doc, one per
+// tag (by is "tag") or one per first segment of the paths (by is "path").
+// Each partial spec keeps only the operations of its group (see [Filter]),
+// the components they use (see [CleanUnused]) and the rest of the document
+// (info, servers...). The title is suffixed with the name of the group.
+//
+// Groups of tags are in the order of the declarations in /tags, then in the
+// order of the operations. Operations without tags are in no group (by "tag"),
+// as well as the root path "/" which has no first segment (by "path").
+func Groups(doc *object, by string) ([]specGroup, error) {
+	var names []string
+	var groupFilters func(name string) *filters
+	switch by {
+	case "tag":
+		names = tagNames(doc)
+		groupFilters = func(name string) *filters {
+			return &filters{Tags: []string{name}}
+		}
+	case "path":
+		if paths, ok := objectProp(doc, "paths"); ok {
+			for _, pth := range paths.Keys() {
+				segment, _, _ := strings.Cut(strings.TrimPrefix(pth, "/"), "/")
+				if segment != "" && !slices.Contains(names, segment) {
+					names = append(names, segment)
+				}
+			}
+		}
+		groupFilters = func(name string) *filters {
+			return &filters{Paths: []string{"/" + name}}
+		}
+	default:
+		return nil, fmt.Errorf("invalid grouping %q (expected: tag or path)", by)
+	}
+
+	groups := make([]specGroup, 0, len(names))
+	for _, name := range names {
+		var rdoc interface{} = deepCopy(doc)
+		if by == "path" {
+			// Webhooks are not under a path
+			rdoc.(*object).Delete("webhooks")
+		}
+		if err := Filter(&rdoc, groupFilters(name)); err != nil {
+			return nil, err
+		}
+		if err := CleanUnused(&rdoc); err != nil {
+			return nil, err
+		}
+		groupDoc := rdoc.(*object)
+		if info, ok := objectProp(groupDoc, "info"); ok {
+			if title, ok := stringProp(info, "title"); ok {
+				info.Set("title", title+" - "+name)
+			}
+		}
+		groups = append(groups, specGroup{name, groupDoc})
+	}
+	return groups, nil
+}
+
+// tagNames returns the tags declared in /tags, then the tags of operations
+// (in /paths and /webhooks) which are not declared.
+func tagNames(doc *object) []string {
+	var names []string
+	add := func(name string) {
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if tags, ok := arrayProp(doc, "tags"); ok {
+		for _, tag := range iterArray[*object](tags) {
+			name, _ := stringProp(tag, "name")
+			add(name)
+		}
+	}
+	for _, section := range []string{"paths", "webhooks"} {
+		items, ok := objectProp(doc, section)
+		if !ok {
+			continue
+		}
+		for _, key := range items.Keys() {
+			item, ok := objectProp(items, key)
+			if !ok {
+				continue
+			}
+			for _, method := range operationMethods {
+				if op, ok := objectProp(item, method); ok {
+					if tags, ok := arrayProp(op, "tags"); ok {
+						for _, tag := range iterArray[string](tags) {
+							add(tag)
+						}
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// groupFileName returns the name of the output file of a group: the group
+// name is inserted before the extension of output.
+func groupFileName(output string, group string) string {
+	ext := filepath.Ext(output)
+	return strings.TrimSuffix(output, ext) + "-" + safeFileName(group) + ext
+}
+
+// writeGroups writes the partial specs of doc grouped by by (see [Groups]) to
+// files named from output (see [groupFileName]).
+func writeGroups(doc interface{}, by string, output string, format string, compact bool) error {
+	root, isObj := doc.(*object)
+	if !isObj {
+		return errors.New("root is not an object")
+	}
+	groups, err := Groups(root, by)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		var buf bytes.Buffer
+		encode, err := newEncoder(&buf, format, compact)
+		if err != nil {
+			return err
+		}
+		if err = encode(g.doc); err != nil {
+			return err
+		}
+		if err = writeFile(groupFileName(output, g.name), buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestGroups(t *testing.T) {
+	const spec = `{
+		"openapi": "3.1.0",
+		"info": {"title": "Shop", "version": "1.0"},
+		"servers": [{"url": "https://shop.example.com"}],
+		"tags": [{"name": "store"}, {"name": "pets"}],
+		"paths": {
+			"/": {"get": {"responses": {"200": {"description": "Home"}}}},
+			"/pets": {"get": {"tags": ["pets"], "responses": {"200": {"$ref": "#/components/responses/Pets"}}}},
+			"/pets/{id}": {"get": {"tags": ["pets", "admin"], "responses": {"200": {"$ref": "#/components/responses/Pets"}}}},
+			"/orders": {"post": {"tags": ["store"], "responses": {"201": {"$ref": "#/components/responses/Order"}}}}
+		},
+		"components": {
+			"responses": {
+				"Pets": {"description": "Pets"},
+				"Order": {"description": "Order"}
+			}
+		}
+	}`
+
+	// The root path and operations without tags are in no group
+	for _, tc := range []struct {
+		by       string
+		expected map[string]string
+		order    []string
+	}{
+		{
+			"tag",
+			map[string]string{
+				"store": `{"openapi":"3.1.0","info":{"title":"Shop - store","version":"1.0"},"servers":[{"url":"https://shop.example.com"}],"tags":[{"name":"store"}],"paths":{"/orders":{"post":{"tags":["store"],"responses":{"201":{"$ref":"#/components/responses/Order"}}}}},"components":{"responses":{"Order":{"description":"Order"}}}}`,
+				"pets":  `{"openapi":"3.1.0","info":{"title":"Shop - pets","version":"1.0"},"servers":[{"url":"https://shop.example.com"}],"tags":[{"name":"pets"}],"paths":{"/pets":{"get":{"tags":["pets"],"responses":{"200":{"$ref":"#/components/responses/Pets"}}}},"/pets/{id}":{"get":{"tags":["pets","admin"],"responses":{"200":{"$ref":"#/components/responses/Pets"}}}}},"components":{"responses":{"Pets":{"description":"Pets"}}}}`,
+				"admin": `{"openapi":"3.1.0","info":{"title":"Shop - admin","version":"1.0"},"servers":[{"url":"https://shop.example.com"}],"paths":{"/pets/{id}":{"get":{"tags":["pets","admin"],"responses":{"200":{"$ref":"#/components/responses/Pets"}}}}},"components":{"responses":{"Pets":{"description":"Pets"}}}}`,
+			},
+			[]string{"store", "pets", "admin"},
+		},
+		{
+			"path",
+			map[string]string{
+				"pets":   `{"openapi":"3.1.0","info":{"title":"Shop - pets","version":"1.0"},"servers":[{"url":"https://shop.example.com"}],"tags":[{"name":"store"},{"name":"pets"}],"paths":{"/pets":{"get":{"tags":["pets"],"responses":{"200":{"$ref":"#/components/responses/Pets"}}}},"/pets/{id}":{"get":{"tags":["pets","admin"],"responses":{"200":{"$ref":"#/components/responses/Pets"}}}}},"components":{"responses":{"Pets":{"description":"Pets"}}}}`,
+				"orders": `{"openapi":"3.1.0","info":{"title":"Shop - orders","version":"1.0"},"servers":[{"url":"https://shop.example.com"}],"tags":[{"name":"store"},{"name":"pets"}],"paths":{"/orders":{"post":{"tags":["store"],"responses":{"201":{"$ref":"#/components/responses/Order"}}}}},"components":{"responses":{"Order":{"description":"Order"}}}}`,
+			},
+			[]string{"pets", "orders"},
+		},
+	} {
+		doc, err := decodeJSON([]byte(spec))
+		if err != nil {
+			t.Fatal(err)
+		}
+		orig, _ := appendJSON(nil, doc)
+		groups, err := Groups(doc, tc.by)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != len(tc.order) {
+			t.Fatalf("%s: %d groups", tc.by, len(groups))
+		}
+		for i, g := range groups {
+			assertString(t, g.name, tc.order[i])
+			b, _ := appendJSON(nil, g.doc)
+			assertString(t, string(b), tc.expected[g.name])
+		}
+		// The source document is unchanged
+		b, _ := appendJSON(nil, doc)
+		assertString(t, string(b), string(orig))
+	}
+
+	assertString(t, groupFileName("dist/api.json", "pets store"), "dist/api-pets_store.json")
+}
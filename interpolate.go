@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dolmen-go/jsonptr"
+)
+
+// Define registers a variable for interpolation, given as "name=value".
+// It also enables interpolation.
+func (ld *loader) Define(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || !isVarName(name) {
+		return fmt.Errorf("%q: <name>=<value> expected", s)
+	}
+	if ld.vars == nil {
+		ld.vars = make(map[string]string)
+	}
+	ld.vars[name] = value
+	ld.interpolate = true
+	return nil
+}
+
+// lookupVar returns the value of a variable defined with Define or, else,
+// from the environment.
+func (ld *loader) lookupVar(name string) (string, bool) {
+	if value, ok := ld.vars[name]; ok {
+		return value, true
+	}
+	return os.LookupEnv(name)
+}
+
+// Interpolate replaces ${VAR} in all string values of doc, if interpolation is enabled.
+func (ld *loader) Interpolate(doc *object) error {
+	if !ld.interpolate {
+		return nil
+	}
+	return interpolateValues(doc, "", ld.lookupVar)
+}
+
+// interpolateValues applies interpolateString to all string values of the
+// (map or array) node v located at ptr.
+func interpolateValues(v interface{}, ptr string, lookup func(string) (string, bool)) error {
+	var err error
+	switch v := v.(type) {
+	case *object:
+		for k, value := range v.All() {
+			p := ptr + "/" + jsonptr.EscapeString(k)
+			if str, isString := value.(string); isString {
+				if str, err = interpolateString(str, lookup); err != nil {
+					return fmt.Errorf("%s: %v", p, err)
+				}
+				v.Set(k, str)
+			} else if err = interpolateValues(value, p, lookup); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			p := fmt.Sprintf("%s/%d", ptr, i)
+			if str, isString := value.(string); isString {
+				if v[i], err = interpolateString(str, lookup); err != nil {
+					return fmt.Errorf("%s: %v", p, err)
+				}
+			} else if err = interpolateValues(value, p, lookup); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// interpolateString expands variables in s:
+//   - ${NAME} is replaced by the value of NAME; an undefined variable is an error
+//   - ${NAME:-default} is replaced by the value of NAME if defined and not empty, else by default
+//   - $${ is replaced by a literal ${
+//
+// Anything else (such as path templates like {id}) is left unchanged.
+func interpolateString(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			// Escaped: $${
+			b.WriteString(s[:i-1])
+			b.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+		end := strings.IndexByte(s[i+2:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated %q", s[i:])
+		}
+		expr := s[i+2 : i+2+end]
+		name, def, hasDefault := strings.Cut(expr, ":-")
+		if !isVarName(name) {
+			return "", fmt.Errorf("invalid variable name in %q", "${"+expr+"}")
+		}
+		value, defined := lookup(name)
+		if hasDefault && value == "" {
+			value, defined = def, true
+		}
+		if !defined {
+			return "", fmt.Errorf("undefined variable %q", name)
+		}
+		b.WriteString(value)
+		s = s[i+3+end:]
+	}
+}
+
+// isVarName returns true if name is made only of letters, digits, '_', '.' and '-'
+// and doesn't start with a digit.
+func isVarName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range []byte(name) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '.', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInterpolateString(t *testing.T) {
+	vars := map[string]string{
+		"HOST":  "api.example.com",
+		"EMPTY": "",
+		"a.b-c": "x",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{"", ""},
+		{"/pets/{id}", "/pets/{id}"},
+		{"$HOST", "$HOST"},
+		{"${HOST}", "api.example.com"},
+		{"https://${HOST}/v1", "https://api.example.com/v1"},
+		{"${HOST}${HOST}", "api.example.comapi.example.com"},
+		{"${a.b-c}", "x"},
+		{"${MISSING:-dflt}", "dflt"},
+		{"${MISSING:-}", ""},
+		{"${EMPTY:-dflt}", "dflt"},
+		{"${EMPTY}", ""},
+		{"${HOST:-dflt}", "api.example.com"},
+		{"$${HOST}", "${HOST}"},
+		{"a $${HOST} ${HOST}", "a ${HOST} api.example.com"},
+	} {
+		got, err := interpolateString(tc.in, lookup)
+		if err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		if got != tc.out {
+			t.Errorf("%q: got %q, expected %q", tc.in, got, tc.out)
+		}
+	}
+
+	for _, in := range []string{
+		"${MISSING}",
+		"${HOST",
+		"${}",
+		"${1X}",
+		"${HO ST}",
+	} {
+		got, err := interpolateString(in, lookup)
+		if err == nil {
+			t.Errorf("%q: error expected, got %q", in, got)
+			continue
+		}
+		t.Logf("%q: %v", in, err)
+	}
+}
+
+func TestExpandRefsInterpolate(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "input.yml"), []byte(`---
+openapi: 3.1.0
+info:
+  $ref: info.yml#/info
+servers:
+- url: https://${HOST}/v1
+paths:
+  /pets/{id}:
+    get:
+      description: Use $${HOST}
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "info.yml"), []byte(`---
+info:
+  title: Pets
+  version: ${VERSION:-0.0.0}
+  contact:
+    email: ${CONTACT}
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CONTACT", "api@example.com")
+	t.Setenv("HOST", "env.example.com")
+
+	var ld loader
+	if err = ld.Define("HOST=api.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if !ld.interpolate {
+		t.Fatal("-D must enable interpolation")
+	}
+
+	var out interface{}
+	err = processFile(filepath.Join(dir, "input.yml"), &ld, func(result interface{}) error {
+		out = result
+		return nil
+	}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(out)
+	assertString(t, string(b), `{"openapi":"3.1.0","info":{"title":"Pets","version":"0.0.0","contact":{"email":"api@example.com"}},"servers":[{"url":"https://api.example.com/v1"}],"paths":{"/pets/{id}":{"get":{"description":"Use ${HOST}"}}}}`)
+
+	// Undefined variable
+	os.Unsetenv("CONTACT")
+	err = processFile(filepath.Join(dir, "input.yml"), &ld, func(interface{}) error { return nil }, &options{})
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	t.Log(err)
+	if !strings.Contains(err.Error(), "/info/contact/email") || !strings.Contains(err.Error(), `"CONTACT"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Disabled
+	err = processFile(filepath.Join(dir, "input.yml"), &loader{}, func(result interface{}) error {
+		out = result
+		return nil
+	}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = json.Marshal(out)
+	assertString(t, string(b), `{"openapi":"3.1.0","info":{"title":"Pets","version":"${VERSION:-0.0.0}","contact":{"email":"${CONTACT}"}},"servers":[{"url":"https://${HOST}/v1"}],"paths":{"/pets/{id}":{"get":{"description":"Use $${HOST}"}}}}`)
+
+	for _, s := range []string{"HOST", "=x", "1A=x"} {
+		if err := (&loader{}).Define(s); err == nil {
+			t.Errorf("-D %q: error expected", s)
+		}
+	}
+}
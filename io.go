@@ -1,55 +1,658 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
+	"mime"
+	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	yaml "gopkg.in/yaml.v3"
 )
 
-func loadURL(u *url.URL) (map[string]interface{}, error) {
-	if u.Scheme != "file" {
+// loader loads the documents referenced by their location.
+type loader struct {
+	// fsys is the file system of local paths. Names in fsys are the absolute
+	// paths without the leading slash. If nil, the file system of the OS is used.
+	fsys fs.FS
+
+	// mappings rewrite location prefixes before loading (like an XML catalog).
+	// Sorted by decreasing prefix length.
+	mappings []mapping
+
+	archives map[string]fs.FS // path of archive -> content
+
+	gitToplevels map[string]string // directory -> toplevel of its git repository
+
+	// interpolate enables ${VAR} interpolation in string values (see [loader.Interpolate]).
+	interpolate bool
+	vars        map[string]string // variables defined with -D
+
+	deps []string // local files loaded, in loading order (see [loader.Deps])
+
+	// sources, if not nil, records the origin of the nodes of the documents
+	// loaded (see [sourceMap]).
+	sources *sources
+
+	// cache, if not nil, holds the documents already parsed. It may be shared
+	// by loaders which then get a copy of the documents (see [loader.Load]).
+	cache docCache
+}
+
+// docCache maps the locations of documents (after mappings) to their content.
+type docCache map[string]cachedDoc
+
+type cachedDoc struct {
+	doc *object
+	pos positions
+}
+
+// mapping rewrites locations starting with prefix to target.
+type mapping struct {
+	prefix string
+	target string // absolute path (slash separated) or URL
+}
+
+// AddMapping registers a mapping of locations prefixes given as "prefix=target".
+// target is a URL or a local path (relative to the current directory).
+func (ld *loader) AddMapping(s string) error {
+	prefix, target, ok := strings.Cut(s, "=")
+	if !ok || prefix == "" || target == "" {
+		return fmt.Errorf("%q: <prefix>=<target> expected", s)
+	}
+	if !isRemote(prefix) {
+		p, err := filepath.Abs(prefix)
+		if err != nil {
+			return err
+		}
+		if os.IsPathSeparator(prefix[len(prefix)-1]) {
+			p += string(filepath.Separator)
+		}
+		prefix = filepath.ToSlash(p)
+	}
+	if !isRemote(target) {
+		t, err := filepath.Abs(target)
+		if err != nil {
+			return err
+		}
+		if os.IsPathSeparator(target[len(target)-1]) {
+			t += string(filepath.Separator)
+		}
+		target = filepath.ToSlash(t)
+	}
+	i := sort.Search(len(ld.mappings), func(i int) bool {
+		return len(ld.mappings[i].prefix) < len(prefix)
+	})
+	ld.mappings = slices.Insert(ld.mappings, i, mapping{prefix, target})
+	return nil
+}
+
+// rewrite applies the mappings (longest prefix first) to a location.
+func (ld *loader) rewrite(pth string) string {
+	for _, m := range ld.mappings {
+		if rest, ok := strings.CutPrefix(pth, m.prefix); ok {
+			if isRemote(pth) && !isRemote(m.target) {
+				if r, err := url.PathUnescape(rest); err == nil {
+					rest = r
+				}
+			}
+			return m.target + rest
+		}
+	}
+	return pth
+}
+
+// FS returns the file system of local paths.
+func (ld *loader) FS() fs.FS {
+	if ld.fsys == nil {
+		return osFS{}
+	}
+	return ld.fsys
+}
+
+// WorkDir returns the directory (slash separated) that locations are made relative to in messages.
+func (ld *loader) WorkDir() string {
+	if ld.fsys != nil {
+		return "/"
+	}
+	cwd, _ := os.Getwd()
+	return filepath.ToSlash(cwd)
+}
+
+// Load loads the document at location pth (see [loadLocation]) after applying mappings.
+// The location may also be a file inside an archive (see [splitArchive]).
+//
+// If the loader has a cache, a document is parsed only once, and a copy of
+// it is returned: the caller is free to modify it.
+func (ld *loader) Load(pth string) (*object, error) {
+	mapped := ld.rewrite(pth)
+	cached, isCached := ld.cache[mapped]
+	doc, pos := cached.doc, cached.pos
+	var err error
+	if !isCached {
+		if ld.sources != nil {
+			pos = make(positions)
+		}
+		if archive, member, isArchived := splitArchive(mapped); isArchived {
+			doc, err = ld.loadArchived(archive, member, pos)
+		} else if isGit(mapped) {
+			if ld.fsys != nil {
+				return nil, errGitFS
+			}
+			doc, err = ld.loadGit(mapped, pos)
+		} else {
+			doc, err = loadLocation(ld.FS(), mapped, pos)
+		}
+		if mapped != pth {
+			err = mappedError(mapped, err)
+		}
+		if err == nil && ld.cache != nil {
+			ld.cache[mapped] = cachedDoc{doc, pos}
+		}
+	}
+	if err == nil {
+		if ld.cache != nil {
+			doc = deepCopy(doc).(*object)
+		}
+		ld.addDep(mapped)
+		ld.sources.addDoc(pth, doc, pos)
+		if err = ld.ExpandTags(doc, pth); err == nil {
+			err = ld.Interpolate(doc)
+		}
+	}
+	return doc, err
+}
+
+// LoadText loads the raw content of the file at location pth (see [loadBytes])
+// after applying mappings.
+func (ld *loader) LoadText(pth string) (string, error) {
+	mapped := ld.rewrite(pth)
+	var b []byte
+	var err error
+	if archive, member, isArchived := splitArchive(mapped); isArchived {
+		b, err = ld.loadArchivedBytes(archive, member)
+	} else if isGit(mapped) {
+		if ld.fsys != nil {
+			return "", errGitFS
+		}
+		b, err = ld.loadGitBytes(mapped)
+	} else {
+		b, err = loadBytes(ld.FS(), mapped)
+	}
+	if mapped != pth {
+		err = mappedError(mapped, err)
+	}
+	if err == nil {
+		ld.addDep(mapped)
+	}
+	return string(b), err
+}
+
+// addDep records the local file read to load location pth: the archive for
+// an archived file. Remote and git locations are not files, so are ignored.
+func (ld *loader) addDep(pth string) {
+	if archive, _, isArchived := splitArchive(pth); isArchived {
+		pth = archive
+	}
+	if isRemote(pth) || isGit(pth) {
+		return
+	}
+	if file, _, err := splitDocSelector(pth); err == nil {
+		pth = file
+	}
+	if !slices.Contains(ld.deps, pth) {
+		ld.deps = append(ld.deps, pth)
+	}
+}
+
+// Deps returns the local files loaded so far, in loading order. Names are
+// relative to the file system of the loader, or, with the OS file system,
+// relative to the current directory if below it.
+func (ld *loader) Deps() []string {
+	deps := make([]string, len(ld.deps))
+	if ld.fsys != nil {
+		for i, pth := range ld.deps {
+			deps[i] = fsName(pth)
+		}
+		return deps
+	}
+	cwd, _ := os.Getwd()
+	for i, pth := range ld.deps {
+		deps[i] = osPath(fsName(pth))
+		if rel, err := filepath.Rel(cwd, deps[i]); err == nil && filepath.IsLocal(rel) {
+			deps[i] = rel
+		}
+	}
+	return deps
+}
+
+// mappedError adds the mapped location to err, if not already there.
+func mappedError(mapped string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, isPathErr := err.(*fs.PathError); isPathErr {
+		return err
+	}
+	return fmt.Errorf("%s: %v", mapped, err)
+}
+
+// isRemote returns true if pth is an http:// or https:// URL.
+func isRemote(pth string) bool {
+	return strings.HasPrefix(pth, "http://") || strings.HasPrefix(pth, "https://")
+}
+
+// osFS is the file system of the OS. Names are absolute paths without
+// the leading slash.
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(osPath(name))
+}
+
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(osPath(name))
+}
+
+// osPath converts a name in osFS to a path of the OS.
+func osPath(name string) string {
+	if filepath.VolumeName(name) == "" {
+		name = "/" + name
+	}
+	return filepath.FromSlash(name)
+}
+
+// fsName converts an absolute path (slash separated) to a name in a loader's file system.
+func fsName(pth string) string {
+	return strings.TrimPrefix(pth, "/")
+}
+
+// loadLocation loads the document at pth which is either an absolute path
+// (slash separated) in fsys or an http:// or https:// URL. If pos is not nil,
+// the positions of the nodes of a YAML document are recorded in pos.
+func loadLocation(fsys fs.FS, pth string, pos positions) (*object, error) {
+	if isRemote(pth) {
+		u, err := url.Parse(pth)
+		if err != nil {
+			return nil, err
+		}
+		return loadURL(u, pos)
+	}
+	return loadFS(fsys, fsName(pth), pos)
+}
+
+func loadURL(u *url.URL, pos positions) (*object, error) {
+	switch u.Scheme {
+	case "file":
+		return loadFile(filepath.FromSlash(u.Path), pos)
+	case "http", "https":
+		return loadHTTP(u, pos)
+	default:
 		return nil, fmt.Errorf("unsupported %q URL scheme", u.Scheme)
 	}
+}
+
+func loadHTTP(u *url.URL, pos positions) (*object, error) {
+	var doc int
+	if q := u.Query(); q.Has("doc") {
+		var err error
+		doc, err = parseDocSelector(q.Get("doc"))
+		if err != nil {
+			return nil, err
+		}
+		q.Del("doc")
+		u2 := *u // Clone
+		u2.RawQuery = q.Encode()
+		u = &u2
+	}
+
+	resp, err := httpGet(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	ext := path.Ext(u.Path)
+	if ext == "" {
+		// No extension in the URL: use the media type as a hint
+		mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if strings.HasSuffix(mediaType, "yaml") {
+			ext = ".yaml"
+		}
+	}
+	r := bufio.NewReader(resp.Body)
+	return loadReader(r, detectFormat(r, ext), doc, pos)
+}
+
+// httpClient loads remote documents.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
 
-	return loadFile(filepath.FromSlash(u.Path))
+func httpGet(u *url.URL) (*http.Response, error) {
+	resp, err := httpClient.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP status %q", resp.Status)
+	}
+	return resp, nil
+}
+
+// loadBytes loads the raw content of the file at pth which is either an
+// absolute path (slash separated) in fsys or an http:// or https:// URL.
+func loadBytes(fsys fs.FS, pth string) ([]byte, error) {
+	if !isRemote(pth) {
+		return fs.ReadFile(fsys, fsName(pth))
+	}
+	u, err := url.Parse(pth)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpGet(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
 }
 
-func loadFile(pth string) (map[string]interface{}, error) {
-	f, err := os.Open(pth)
+// loadFile loads the document at pth, a path of the OS. A "?doc=N" suffix
+// selects the Nth document (starting at 1) of a YAML stream.
+func loadFile(pth string, pos positions) (*object, error) {
+	pth, err := filepath.Abs(pth)
+	if err != nil {
+		return nil, err
+	}
+	return loadFS(osFS{}, fsName(filepath.ToSlash(pth)), pos)
+}
+
+// loadFS loads the document name from fsys. A "?doc=N" suffix selects the Nth
+// document (starting at 1) of a YAML stream.
+func loadFS(fsys fs.FS, name string, pos positions) (*object, error) {
+	name, doc, err := splitDocSelector(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := fsys.Open(name)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
 
-	var load func(io.Reader) (map[string]interface{}, error)
-	switch filepath.Ext(pth) {
-	case ".json":
-		load = loadJSON
-	case ".yaml", ".yml":
-		load = loadYAML
+	return loadNamed(f, name, doc, pos)
+}
+
+// loadNamed loads a document from r. The extension of name is used as
+// a hint for detecting the format.
+func loadNamed(r io.Reader, name string, doc int, pos positions) (*object, error) {
+	br := bufio.NewReader(r)
+	return loadReader(br, detectFormat(br, path.Ext(name)), doc, pos)
+}
+
+// splitDocSelector removes the "?doc=N" suffix from pth.
+func splitDocSelector(pth string) (string, int, error) {
+	i := strings.LastIndex(pth, "?doc=")
+	if i < 0 {
+		return pth, 0, nil
+	}
+	doc, err := parseDocSelector(pth[i+5:])
+	if err != nil {
+		return "", 0, err
+	}
+	return pth[:i], doc, nil
+}
+
+func parseDocSelector(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid document selector %q", "?doc="+s)
+	}
+	return n, nil
+}
+
+// detectFormat guesses the format of the content of r from the first non-blank byte:
+// '{' means JSON, anything else means YAML.
+//
+// ext (a file extension) is only a hint: as YAML flow mappings also start
+// with '{', a ".yaml" or ".yml" extension selects YAML. A ".jsonc" or
+// ".json5" extension selects JSON with comments ("jsonc"): without that
+// extension (on stdin for example) the format must be given explicitly.
+//
+// A UTF-8 BOM is skipped from r.
+func detectFormat(r *bufio.Reader, ext string) string {
+	skipBOM(r)
+	if ext == ".jsonc" || ext == ".json5" {
+		return "jsonc"
+	}
+	for i := 1; ; i++ {
+		b, _ := r.Peek(i)
+		if len(b) < i {
+			return "yaml"
+		}
+		switch b[i-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{':
+			if ext == ".yaml" || ext == ".yml" {
+				return "yaml"
+			}
+			return "json"
+		default:
+			return "yaml"
+		}
+	}
+}
+
+// skipBOM skips the UTF-8 BOM at the start of r, if any.
+func skipBOM(r *bufio.Reader) {
+	if b, _ := r.Peek(3); string(b) == "\xEF\xBB\xBF" {
+		r.Discard(3)
+	}
+}
+
+// loadReader loads a document in the given format ("json", "jsonc" or "yaml").
+//
+// doc selects a document (starting at 1) in a YAML stream. 0 means that the
+// stream must contain a single document.
+//
+// If pos is not nil, the positions of the nodes of a YAML document are
+// recorded in pos.
+func loadReader(r io.Reader, format string, doc int, pos positions) (*object, error) {
+	switch format {
+	case "json", "jsonc":
+		if doc > 1 {
+			return nil, fmt.Errorf("document %d not found: JSON holds a single document", doc)
+		}
+		if format == "jsonc" {
+			return loadJSONC(r)
+		}
+		return loadJSON(r)
+	case "yaml":
+		return loadYAML(r, doc, pos)
 	default:
-		return nil, errors.New("unsupported file extension")
+		return nil, fmt.Errorf("unsupported format %q", format)
 	}
-	return load(f)
 }
 
-func loadYAML(r io.Reader) (map[string]interface{}, error) {
-	data, err := loadAny(yaml.NewDecoder(r))
+func loadYAML(r io.Reader, doc int, pos positions) (*object, error) {
+	dec := yaml.NewDecoder(r)
+	var selected *yaml.Node
+	var count int
+	for {
+		var node yaml.Node
+		err := dec.Decode(&node)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		count++
+		if count == doc || (doc == 0 && count == 1) {
+			selected = &node
+		}
+	}
+	switch {
+	case doc == 0 && count > 1:
+		return nil, fmt.Errorf("YAML stream holds %d documents: select one with \"?doc=N\"", count)
+	case selected == nil && count > 0:
+		return nil, fmt.Errorf("document %d not found: YAML stream holds %d documents", doc, count)
+	case selected == nil:
+		return nil, io.EOF
+	}
+
+	if err := expandYAMLTags(selected); err != nil {
+		return nil, err
+	}
+
+	data, err := loadAny(selected)
 	if err != nil {
 		return nil, err
 	}
-	return fixMaps(data).(map[string]interface{}), err
+	fixed := fixMaps(data)
+	if err = fixYAMLScalars(selected, fixed); err != nil {
+		return nil, err
+	}
+	return yamlObjects(selected, fixed, "", pos).(*object), nil
+}
+
+// yamlTags maps custom YAML tags to the keyword they are an alternate syntax for.
+var yamlTags = map[string]string{
+	"!ref":     "$ref",
+	"!include": "$inline",
+}
+
+// loaderTags are the custom YAML tags whose scalars are kept as a [taggedValue]
+// for the loader to replace once the document is loaded (see [loader.ExpandTags]).
+var loaderTags = map[string]bool{
+	"!env":  true,
+	"!text": true,
+}
+
+// taggedValue is a scalar with one of the [loaderTags].
+type taggedValue struct {
+	Tag   string
+	Value string
+	Line  int
+}
+
+// expandYAMLTags replaces nodes having custom tags:
+//   - !ref <link> is replaced by {"$ref": "<link>"}
+//   - !include <link> is replaced by {"$inline": "<link>"}
+//
+// !env and !text are checked to apply to a scalar.
+func expandYAMLTags(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.SequenceNode, yaml.MappingNode:
+		if _, isCustom := yamlTags[n.Tag]; isCustom || loaderTags[n.Tag] {
+			return fmt.Errorf("line %d: %s applies only to a scalar", n.Line, n.Tag)
+		}
+		fallthrough
+	case yaml.DocumentNode:
+		for _, child := range n.Content {
+			if err := expandYAMLTags(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	case yaml.ScalarNode:
+	default:
+		return nil
+	}
+
+	keyword, isCustom := yamlTags[n.Tag]
+	if !isCustom {
+		return nil
+	}
+	*n = yaml.Node{
+		Kind:   yaml.MappingNode,
+		Tag:    "!!map",
+		Line:   n.Line,
+		Column: n.Column,
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: keyword, Line: n.Line, Column: n.Column},
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: n.Value, Line: n.Line, Column: n.Column},
+		},
+	}
+	return nil
+}
+
+// ExpandTags replaces the [taggedValue] scalars of doc, loaded from location pth:
+//   - !env <name> is replaced by the value of the variable (see [loader.lookupVar])
+//   - !text <file> is replaced by the content of the file (relative to pth) as a string
+func (ld *loader) ExpandTags(doc *object, pth string) error {
+	var expand func(v interface{}) (interface{}, error)
+	expand = func(v interface{}) (interface{}, error) {
+		var err error
+		switch v := v.(type) {
+		case *object:
+			for k, value := range v.All() {
+				if value, err = expand(value); err != nil {
+					return nil, err
+				}
+				v.Set(k, value)
+			}
+		case []interface{}:
+			for i, value := range v {
+				if v[i], err = expand(value); err != nil {
+					return nil, err
+				}
+			}
+		case taggedValue:
+			return ld.expandTag(v, pth)
+		}
+		return v, nil
+	}
+	_, err := expand(doc)
+	return err
+}
+
+// expandTag returns the value of a scalar with one of the [loaderTags] found
+// in the document at location pth.
+func (ld *loader) expandTag(v taggedValue, pth string) (string, error) {
+	switch v.Tag {
+	case "!env":
+		value, ok := ld.lookupVar(v.Value)
+		if !ok {
+			return "", fmt.Errorf("line %d: !env: undefined variable %q", v.Line, v.Value)
+		}
+		return value, nil
+	default: // !text
+		if strings.IndexByte(v.Value, '#') >= 0 {
+			return "", fmt.Errorf("line %d: !text: fragment not allowed", v.Line)
+		}
+		file, err := resolveLocation(pth, v.Value)
+		if err != nil {
+			return "", fmt.Errorf("line %d: !text: %v", v.Line, err)
+		}
+		text, err := ld.LoadText(file)
+		if err != nil {
+			return "", fmt.Errorf("line %d: !text: %v", v.Line, err)
+		}
+		return text, nil
+	}
 }
 
 func fixMaps(v interface{}) interface{} {
 	switch v := v.(type) {
-	case nil, bool, string, int, int64, float64:
+	case nil, bool, string, int, int64, float64, json.Number:
 	case []interface{}:
 		for i, item := range v {
 			v[i] = fixMaps(item)
@@ -68,16 +671,153 @@ func fixMaps(v interface{}) interface{} {
 	return v
 }
 
-func loadJSON(r io.Reader) (map[string]interface{}, error) {
-	dec := json.NewDecoder(r)
-	data, err := loadAny(dec)
+// fixYAMLScalars fixes the values of v (decoded from n) to keep them as written:
+// numbers are replaced by a [json.Number] holding their source text (normalized
+// if not valid in JSON), and keys of objects are the source text.
+func fixYAMLScalars(n *yaml.Node, v interface{}) error {
+	_, err := fixYAMLScalar(n, v)
+	return err
+}
+
+func fixYAMLScalar(n *yaml.Node, v interface{}) (interface{}, error) {
+	var err error
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) > 0 {
+			return fixYAMLScalar(n.Content[0], v)
+		}
+	case yaml.AliasNode:
+		return fixYAMLScalar(n.Alias, v)
+	case yaml.ScalarNode:
+		if tag := n.ShortTag(); tag == "!!int" || tag == "!!float" {
+			return yamlNumber(n, v)
+		}
+	case yaml.SequenceNode:
+		arr, isArray := v.([]interface{})
+		if !isArray || len(arr) != len(n.Content) {
+			break
+		}
+		for i, item := range n.Content {
+			if arr[i], err = fixYAMLScalar(item, arr[i]); err != nil {
+				return nil, err
+			}
+		}
+	case yaml.MappingNode:
+		obj, isObj := v.(map[string]interface{})
+		if !isObj {
+			break
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if key.Kind != yaml.ScalarNode || key.Tag == "!!merge" {
+				continue
+			}
+			if _, exists := obj[key.Value]; !exists {
+				// Key decoded as a number (1.10 => "1.1") or other non-string
+				var k interface{}
+				if key.Decode(&k) == nil {
+					if val, exists := obj[fmt.Sprint(k)]; exists {
+						delete(obj, fmt.Sprint(k))
+						obj[key.Value] = val
+					}
+				}
+			}
+			if val, exists := obj[key.Value]; exists {
+				if obj[key.Value], err = fixYAMLScalar(value, val); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return v, nil
+}
+
+// yamlNumber returns the source text of the YAML number n (decoded as v) as a
+// [json.Number]. Numbers not valid in JSON (0x1F, +1, .5...) are normalized.
+func yamlNumber(n *yaml.Node, v interface{}) (interface{}, error) {
+	if json.Valid([]byte(n.Value)) {
+		return json.Number(n.Value), nil
+	}
+	switch v := v.(type) {
+	case int:
+		return json.Number(strconv.Itoa(v)), nil
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10)), nil
+	case uint64:
+		return json.Number(strconv.FormatUint(v, 10)), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("line %d: %s is not a valid JSON number", n.Line, n.Value)
+		}
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), nil
+	}
+	return v, nil
+}
+
+func loadJSON(r io.Reader) (*object, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
+	return decodeJSON(data)
+}
+
+// loadJSONC loads JSON with comments and trailing commas.
+func loadJSONC(r io.Reader) (*object, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	stripped, err := stripJSONC(data)
+	if err != nil {
+		return nil, jsonErrorPosition(data, err)
+	}
+	return decodeJSON(stripped)
+}
+
+func decodeJSON(data []byte) (*object, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // Keep numbers as written
+	doc, err := loadAny(dec)
+	if err != nil {
+		return nil, jsonErrorPosition(data, err)
+	}
 	if dec.More() {
-		return nil, errors.New("unexpected data after JSON content")
+		offset := dec.InputOffset()
+		offset += int64(len(data[offset:]) - len(bytes.TrimLeft(data[offset:], " \t\r\n")))
+		return nil, jsonErrorPosition(data, &jsonSyntaxError{offset + 1, errors.New("unexpected data after JSON content")})
 	}
-	return data, err
+	obj, err := jsonObjects(json.NewDecoder(bytes.NewReader(data)), doc)
+	if err != nil {
+		return nil, err
+	}
+	return obj.(*object), nil
+}
+
+// jsonErrorPosition adds the line and column to a JSON decoding error.
+func jsonErrorPosition(data []byte, err error) error {
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	case *jsonSyntaxError:
+		offset = e.Offset
+	default:
+		return err
+	}
+	// Offset is just after the offending byte
+	if offset > 0 {
+		offset--
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte{'\n'}) + 1
+	column := utf8.RuneCount(before[bytes.LastIndexByte(before, '\n')+1:]) + 1
+	return fmt.Errorf("line %d, column %d: %v", line, column, err)
 }
 
 func loadAny(decoder interface{ Decode(interface{}) error }) (map[string]interface{}, error) {
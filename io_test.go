@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDetectFormat(t *testing.T) {
+	for _, tc := range []struct {
+		content  string
+		ext      string
+		expected string
+	}{
+		{`{"a":1}`, "", "json"},
+		{" \n\t{\"a\":1}", ".tmpl", "json"},
+		{"\xEF\xBB\xBF{\"a\":1}", "", "json"},
+		{`{"a":1}`, ".json", "json"},
+		{`{a: 1}`, ".yaml", "yaml"},
+		{`{a: 1}`, ".yml", "yaml"},
+		{"---\na: 1\n", "", "yaml"},
+		{"a: 1\n", ".json", "yaml"},
+		{"", "", "yaml"},
+		{"   ", "", "yaml"},
+	} {
+		got := detectFormat(bufio.NewReader(strings.NewReader(tc.content)), tc.ext)
+		if got != tc.expected {
+			t.Errorf("%q (%q): got %q, expected %q", tc.content, tc.ext, got, tc.expected)
+		}
+	}
+}
+
+func TestLoadFileAnyExtension(t *testing.T) {
+	dir := t.TempDir()
+	expected := map[string]interface{}{"a": "b"}
+	for name, content := range map[string]string{
+		"api.yaml.tmpl": "a: b\n",
+		"api.json.tmpl": `{"a": "b"}`,
+		"api.openapi":   "---\na: b\n",
+		"api":           "\xEF\xBB\xBF{\"a\": \"b\"}\n",
+	} {
+		pth := filepath.Join(dir, name)
+		if err := os.WriteFile(pth, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := loadFile(pth, nil)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !equalJSON(got, expected) {
+			t.Errorf("%s: got %#v", name, got)
+		}
+	}
+}
+
+func TestLoadFileYAMLStream(t *testing.T) {
+	const stream = "testdata/11-ref-multidoc/stream.yml"
+
+	_, err := loadFile(stream, nil)
+	if err == nil || !strings.Contains(err.Error(), "3 documents") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	got, err := loadFile(stream+"?doc=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.Get("info"); !ok {
+		t.Errorf("got %#v", got)
+	}
+
+	for _, sel := range []string{"?doc=0", "?doc=4", "?doc=x"} {
+		_, err = loadFile(stream+sel, nil)
+		if err == nil {
+			t.Errorf("%s: error expected", sel)
+		} else {
+			t.Logf("%s: %v", sel, err)
+		}
+	}
+
+	err = processFile(stream, &loader{}, func(interface{}) error { return nil }, &options{})
+	if err == nil || !strings.HasPrefix(err.Error(), stream+": ") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLoadYAMLTags(t *testing.T) {
+	t.Setenv("OPENAPI_TEST_HOST", "api.example.com")
+	t.Setenv("OPENAPI_TEST_VERSION", "1.0")
+
+	fsys := fstest.MapFS{
+		"api/openapi.yaml": {Data: []byte(`
+host: !env OPENAPI_TEST_HOST
+version: !env OPENAPI_TEST_VERSION
+info: !include info.yml#/info
+paths: !ref paths.yml#/paths
+x-text: !text README.md
+x-other: !custom value
+`)},
+		"api/README.md": {Data: []byte("Read me")},
+		"api/bad.yaml":  {Data: []byte("host: !env OPENAPI_TEST_UNDEFINED\n")},
+	}
+	ld := loader{fsys: fsys}
+	got, err := ld.Load("/api/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"host":    "api.example.com",
+		"version": "1.0",
+		"info":    map[string]interface{}{"$inline": "info.yml#/info"},
+		"paths":   map[string]interface{}{"$ref": "paths.yml#/paths"},
+		"x-text":  "Read me",
+		"x-other": "value",
+	}
+	if !equalJSON(got, expected) {
+		t.Errorf("got %#v", got)
+	}
+
+	// Variables defined with -D take precedence over the environment
+	ld = loader{fsys: fsys}
+	if err = ld.Define("OPENAPI_TEST_VERSION=2.0"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = ld.Load("/api/openapi.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	expected["version"] = "2.0"
+	if !equalJSON(got, expected) {
+		t.Errorf("got %#v", got)
+	}
+
+	_, err = ld.Load("/api/bad.yaml")
+	if err == nil || !strings.Contains(err.Error(), `undefined variable "OPENAPI_TEST_UNDEFINED"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	for _, src := range []string{
+		"info: !include {a: 1}\n",
+		"info: !text [a]\n",
+	} {
+		_, err = loadYAML(strings.NewReader(src), 0, nil)
+		if err == nil {
+			t.Errorf("%q: error expected", src)
+		} else {
+			t.Logf("%q: %v", src, err)
+		}
+	}
+}
+
+func TestLoaderDeps(t *testing.T) {
+	var ld loader
+	err := processFile("testdata/41-inline-indirect/input.yml", &ld, func(interface{}) error { return nil }, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.FromSlash("testdata/41-inline-indirect/input.yml"),
+		filepath.FromSlash("testdata/41-inline-indirect/indirect.yml"),
+		filepath.FromSlash("testdata/common/info.yml"),
+	}
+	if got := ld.Deps(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+
+	// Documents of a YAML stream, text files and archives
+	fsys := fstest.MapFS{
+		"api/openapi.yaml": {Data: []byte("openapi: 3.1.0\ninfo: {$ref: 'info.yml?doc=2#/info'}\npaths: {$ref: 'info.yml?doc=1#/paths'}\nx-text: !text README.md\n")},
+		"api/info.yml":     {Data: []byte("paths: {}\n---\ninfo: {title: T, version: '1'}\n")},
+		"api/README.md":    {Data: []byte("Read me")},
+	}
+	ld = loader{fsys: fsys}
+	err = processFile("api/openapi.yaml", &ld, func(interface{}) error { return nil }, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"api/openapi.yaml", "api/README.md", "api/info.yml"}
+	if got := ld.Deps(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+
+	ld.addDep("/api/specs.zip!/openapi.yaml")
+	ld.addDep("https://example.com/api.yaml")
+	ld.addDep("git:HEAD:/api/openapi.yaml")
+	expected = append(expected, "api/specs.zip")
+	if got := ld.Deps(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
+
+func TestLoadNumbers(t *testing.T) {
+	for _, tc := range []struct {
+		format, input, output string
+	}{
+		{"json", `{"a":[12345678901234567890123,1.10,-0.0,1e3,9007199254740993]}`, `{"a":[12345678901234567890123,1.10,-0.0,1e3,9007199254740993]}`},
+		{"yaml", "a: [12345678901234567890123, 1.10, -0.0, 1e3, 9007199254740993]", `{"a":[12345678901234567890123,1.10,-0.0,1e3,9007199254740993]}`},
+		// Not valid JSON numbers
+		{"yaml", "a: [0x1F, 0o17, +1, .5, 1.]", `{"a":[31,15,1,0.5,1]}`},
+		// Keys are kept as written
+		{"yaml", "1.10: a\n2: b\n", `{"1.10":"a","2":"b"}`},
+		// Quoted numbers are strings
+		{"yaml", "a: '1.10'", `{"a":"1.10"}`},
+	} {
+		doc, err := loadReader(strings.NewReader(tc.input), tc.format, 0, nil)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+			continue
+		}
+		b, err := appendJSON(nil, doc)
+		if err != nil {
+			t.Errorf("%s: %v", tc.input, err)
+			continue
+		}
+		assertString(t, string(b), tc.output)
+	}
+
+	_, err := loadYAML(strings.NewReader("a: .nan"), 0, nil)
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	t.Log(err)
+}
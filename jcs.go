@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// appendCanonicalJSON appends the JSON Canonicalization Scheme (RFC 8785)
+// encoding of v to buf: no whitespace, object keys sorted by UTF-16 code
+// units, minimal string escaping and numbers serialized like ECMAScript.
+func appendCanonicalJSON(buf []byte, v interface{}) ([]byte, error) {
+	var err error
+	switch v := v.(type) {
+	case nil:
+		return append(buf, "null"...), nil
+	case bool:
+		return strconv.AppendBool(buf, v), nil
+	case string:
+		return appendCanonicalString(buf, v), nil
+	case float64:
+		return appendCanonicalNumber(buf, v)
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendCanonicalNumber(buf, f)
+	case int:
+		return appendCanonicalNumber(buf, float64(v))
+	case int64:
+		return appendCanonicalNumber(buf, float64(v))
+	case uint64:
+		return appendCanonicalNumber(buf, float64(v))
+	case *object:
+		keys := slices.Clone(v.Keys())
+		sort.Slice(keys, func(i, j int) bool {
+			return compareUTF16(keys[i], keys[j]) < 0
+		})
+		buf = append(buf, '{')
+		for i, k := range keys {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = append(appendCanonicalString(buf, k), ':')
+			value, _ := v.Get(k)
+			if buf, err = appendCanonicalJSON(buf, value); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, '}'), nil
+	case []interface{}:
+		buf = append(buf, '[')
+		for i, item := range v {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			if buf, err = appendCanonicalJSON(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, ']'), nil
+	default:
+		return nil, fmt.Errorf("unexpected %T value", v)
+	}
+}
+
+// compareUTF16 compares strings by their UTF-16 code units.
+func compareUTF16(a, b string) int {
+	for a != "" && b != "" {
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if ra != rb {
+			// Only characters outside the BMP (encoded as surrogates) sort
+			// differently from code points
+			ua, ub := utf16Unit(ra), utf16Unit(rb)
+			if ua != ub {
+				return int(ua) - int(ub)
+			}
+			return int(ra) - int(rb)
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return len(a) - len(b)
+}
+
+// utf16Unit returns the first UTF-16 code unit of r.
+func utf16Unit(r rune) rune {
+	if r1, _ := utf16.EncodeRune(r); r1 != utf8.RuneError {
+		return r1
+	}
+	return r
+}
+
+func appendCanonicalString(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"', '\\':
+			buf = append(buf, '\\', c)
+		case '\b':
+			buf = append(buf, '\\', 'b')
+		case '\f':
+			buf = append(buf, '\\', 'f')
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case '\t':
+			buf = append(buf, '\\', 't')
+		default:
+			if c < 0x20 {
+				buf = append(buf, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			} else {
+				buf = append(buf, c)
+			}
+		}
+	}
+	return append(buf, '"')
+}
+
+// appendCanonicalNumber appends f serialized like ECMAScript Number.prototype.toString.
+func appendCanonicalNumber(buf []byte, f float64) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, errors.New("NaN and Infinity are not valid JSON numbers")
+	}
+	if f == 0 { // Also -0
+		return append(buf, '0'), nil
+	}
+	if f < 0 {
+		buf = append(buf, '-')
+		f = -f
+	}
+
+	// Shortest representation that round trips: d.ddddde±x
+	e := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exp, _ := strings.Cut(e, "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	x, _ := strconv.Atoi(exp)
+	n := x + 1 // f = 0.digits × 10^n
+	k := len(digits)
+
+	switch {
+	case k <= n && n <= 21:
+		buf = append(buf, digits...)
+		buf = append(buf, strings.Repeat("0", n-k)...)
+	case 0 < n && n <= 21:
+		buf = append(buf, digits[:n]...)
+		buf = append(buf, '.')
+		buf = append(buf, digits[n:]...)
+	case -6 < n && n <= 0:
+		buf = append(buf, "0."...)
+		buf = append(buf, strings.Repeat("0", -n)...)
+		buf = append(buf, digits...)
+	default:
+		buf = append(buf, digits[0])
+		if k > 1 {
+			buf = append(buf, '.')
+			buf = append(buf, digits[1:]...)
+		}
+		buf = append(buf, 'e')
+		if n-1 >= 0 {
+			buf = append(buf, '+')
+		}
+		buf = strconv.AppendInt(buf, int64(n-1), 10)
+	}
+	return buf, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalNumber(t *testing.T) {
+	// RFC 8785, Appendix B
+	for _, tc := range []struct {
+		bits uint64
+		out  string
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0xffefffffffffffff, "-1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+		{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x41b3de4355555554, "333333333.33333325"},
+		{0x41b3de4355555555, "333333333.3333333"},
+		{0x41b3de4355555556, "333333333.3333334"},
+		{0x41b3de4355555557, "333333333.33333343"},
+		{0xbecbf647612f3696, "-0.0000033333333333333333"},
+		{0x43143ff3c1cb0959, "1424953923781206.2"},
+	} {
+		b, err := appendCanonicalNumber(nil, math.Float64frombits(tc.bits))
+		if err != nil {
+			t.Errorf("%#x: %v", tc.bits, err)
+			continue
+		}
+		assertString(t, string(b), tc.out)
+	}
+
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := appendCanonicalNumber(nil, f); err == nil {
+			t.Errorf("%v: error expected", f)
+		}
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	// RFC 8785, section 3.2.3
+	doc, err := decodeJSON([]byte(`{
+		"€": "Euro Sign",
+		"\r": "Carriage Return",
+		"דּ": "Hebrew Letter Dalet With Dagesh",
+		"1": "One",
+		"😀": "Emoji: Grinning Face",
+		"\u0080": "Control",
+		"ö": "Latin Small Letter O With Diaeresis"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := appendCanonicalJSON(nil, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, s := range strings.Split(string(b), `","`) {
+		keys = append(keys, s[strings.Index(s, `":"`)+3:])
+	}
+	assertString(t, strings.Join(keys, "|"), `Carriage Return|One|Control|Latin Small Letter O With Diaeresis|Euro Sign|Emoji: Grinning Face|Hebrew Letter Dalet With Dagesh"}`)
+
+	// RFC 8785, section 3.2.2
+	doc, err = decodeJSON([]byte(`{
+		"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+		"string": "€$\u000F\u000aA'B\u0022\u005c\\\u0022\/",
+		"literals": [null, true, false]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = appendCanonicalJSON(nil, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, string(b), `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`)
+
+	b, err = appendCanonicalJSON(nil, toObjects(map[string]interface{}{"int": 42, "html": "<&>", "ls": " "}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, string(b), "{\"html\":\"<&>\",\"int\":42,\"ls\":\" \"}")
+}
+
+func TestDigestLine(t *testing.T) {
+	line, err := digestLine("sha256", []byte("{}"), "api.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, line, "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a  api.json\n")
+	if _, err := digestLine("md5", nil, "-"); err == nil {
+		t.Error("error expected")
+	}
+}
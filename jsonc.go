@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+)
+
+// stripJSONC converts JSONC (JSON with comments and trailing commas) to JSON.
+//
+// Comments and trailing commas are replaced by spaces, so offsets (and so the
+// line and column numbers reported in errors) are preserved.
+func stripJSONC(data []byte) ([]byte, error) {
+	out := bytes.Clone(data)
+	lastComma := -1
+	for i := 0; i < len(out); i++ {
+		switch out[i] {
+		case '"':
+			for i++; i < len(out) && out[i] != '"'; i++ {
+				if out[i] == '\\' {
+					i++
+				}
+			}
+			lastComma = -1
+		case '/':
+			if i+1 < len(out) && out[i+1] == '/' {
+				for ; i < len(out) && out[i] != '\n'; i++ {
+					out[i] = ' '
+				}
+				continue
+			}
+			if i+1 < len(out) && out[i+1] == '*' {
+				end := bytes.Index(out[i+2:], []byte("*/"))
+				if end < 0 {
+					return nil, &jsonSyntaxError{int64(i + 1), errors.New("unterminated comment")}
+				}
+				end += i + 4
+				for ; i < end; i++ {
+					if out[i] != '\n' {
+						out[i] = ' '
+					}
+				}
+				i--
+				continue
+			}
+			lastComma = -1
+		case ',':
+			lastComma = i
+		case ']', '}':
+			if lastComma >= 0 {
+				out[lastComma] = ' '
+			}
+			lastComma = -1
+		case ' ', '\t', '\r', '\n':
+		default:
+			lastComma = -1
+		}
+	}
+	return out, nil
+}
+
+// jsonSyntaxError is a syntax error located at Offset (as [encoding/json.SyntaxError]).
+type jsonSyntaxError struct {
+	Offset int64
+	err    error
+}
+
+func (e *jsonSyntaxError) Error() string {
+	return e.err.Error()
+}
+
+func (e *jsonSyntaxError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStripJSONC(t *testing.T) {
+	for _, tc := range []struct {
+		in, out string
+	}{
+		{`{"a": 1}`, `{"a": 1}`},
+		{`{"a": 1,}`, `{"a": 1 }`},
+		{`[1, 2, ]`, `[1, 2  ]`},
+		{"{\"a\": 1, // comment\n}", "{\"a\": 1            \n}"},
+		{`{/* a */"a": /* b */1}`, `{       "a":        1}`},
+		{"/* a\nb */{}", "    \n    {}"},
+		{`{"a": "// not a comment, /* */",}`, `{"a": "// not a comment, /* */" }`},
+		{`{"a": "\"//\"",}`, `{"a": "\"//\"" }`},
+	} {
+		got, err := stripJSONC([]byte(tc.in))
+		if err != nil {
+			t.Errorf("%q: %v", tc.in, err)
+			continue
+		}
+		assertString(t, string(got), tc.out)
+	}
+
+	if _, err := stripJSONC([]byte(`{/* }`)); err == nil {
+		t.Error("error expected for unterminated comment")
+	}
+}
+
+func TestLoadFileJSONC(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"api.jsonc", "api.json5"} {
+		pth := filepath.Join(dir, name)
+		err := os.WriteFile(pth, []byte(`// Partial
+{
+	"a": "b", // trailing comma
+	/* "c": 1, */
+}
+`), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := loadFile(pth, nil)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !equalJSON(got, map[string]interface{}{"a": "b"}) {
+			t.Errorf("%s: got %#v", name, got)
+		}
+	}
+
+	// UTF-8 BOM
+	pth := filepath.Join(dir, "bom.jsonc")
+	if err := os.WriteFile(pth, []byte("\xEF\xBB\xBF{\"a\": \"b\", // comment\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := loadFile(pth, nil); err != nil {
+		t.Errorf("%s: %v", pth, err)
+	} else if !equalJSON(got, map[string]interface{}{"a": "b"}) {
+		t.Errorf("%s: got %#v", pth, got)
+	}
+
+	pth = filepath.Join(dir, "error.jsonc")
+	err := os.WriteFile(pth, []byte("{\n\t// comment\n\t\"a\": \"é\" \"b\"\n}\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadFile(pth, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3, column 11: ") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/dolmen-go/jsonptr"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlObjects returns v (decoded from n) with its maps replaced by objects
+// with keys in the order of the source. If pos is not nil, the positions of
+// the nodes (v is at ptr) are recorded in pos.
+func yamlObjects(n *yaml.Node, v interface{}, ptr string, pos positions) interface{} {
+	if pos != nil {
+		pos[ptr] = position{n.Line, n.Column}
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) > 0 {
+			return yamlObjects(n.Content[0], v, ptr, pos)
+		}
+	case yaml.AliasNode:
+		return yamlObjects(n.Alias, v, ptr, pos)
+	case yaml.ScalarNode:
+		if loaderTags[n.Tag] {
+			return taggedValue{n.Tag, n.Value, n.Line}
+		}
+	case yaml.SequenceNode:
+		if arr, isArray := v.([]interface{}); isArray && len(arr) == len(n.Content) {
+			for i, item := range n.Content {
+				arr[i] = yamlObjects(item, arr[i], ptr+"/"+strconv.Itoa(i), pos)
+			}
+			return arr
+		}
+	case yaml.MappingNode:
+		m, isMap := v.(map[string]interface{})
+		if !isMap {
+			break
+		}
+		pairs := yamlPairs(n, false)
+		// An explicit key overrides merged ones, the first merged key
+		// overrides the next ones
+		nodes := make(map[string]*yaml.Node, len(pairs))
+		for _, p := range pairs {
+			if _, seen := nodes[p.key]; !seen || !p.merged {
+				nodes[p.key] = p.value
+			}
+		}
+		obj := newObject(len(m))
+		for _, p := range pairs {
+			// The first occurrence of a key gives its position
+			if value, exists := m[p.key]; exists {
+				if _, done := obj.Get(p.key); !done {
+					obj.Set(p.key, yamlObjects(nodes[p.key], value, ptr+"/"+jsonptr.EscapeString(p.key), pos))
+				}
+			}
+		}
+		if obj.Len() < len(m) {
+			// Keys not found in the source, such as non-string keys
+			for _, k := range sortedKeys(m) {
+				if _, done := obj.Get(k); !done {
+					obj.Set(k, toObjects(m[k]))
+				}
+			}
+		}
+		return obj
+	}
+	return toObjects(v)
+}
+
+// yamlPair is a key and the node of its value in a YAML mapping.
+type yamlPair struct {
+	key    string
+	value  *yaml.Node
+	merged bool // from a merge key
+}
+
+// yamlPairs returns the pairs of the mapping n, in order. The pairs of the
+// mappings referenced by a merge key ("<<: *alias") come at the position of
+// the merge key.
+func yamlPairs(n *yaml.Node, merged bool) (pairs []yamlPair) {
+	switch n.Kind {
+	case yaml.AliasNode:
+		return yamlPairs(n.Alias, merged)
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			pairs = append(pairs, yamlPairs(item, merged)...)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Tag == "!!merge" {
+				pairs = append(pairs, yamlPairs(n.Content[i+1], true)...)
+			} else {
+				pairs = append(pairs, yamlPair{n.Content[i].Value, n.Content[i+1], merged})
+			}
+		}
+	}
+	return
+}
+
+// jsonObjects returns v with its maps replaced by objects with keys in the
+// order of the tokens of the JSON document it was decoded from.
+func jsonObjects(dec *json.Decoder, v interface{}) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		m, _ := v.(map[string]interface{})
+		obj := newObject(len(m))
+		for dec.More() {
+			tok, err = dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := tok.(string)
+			value, err := jsonObjects(dec, m[key])
+			if err != nil {
+				return nil, err
+			}
+			// The last occurrence of a key gives its value
+			obj.Set(key, value)
+		}
+		_, err = dec.Token() // '}'
+		return obj, err
+	case json.Delim('['):
+		arr, _ := v.([]interface{})
+		for i := 0; dec.More(); i++ {
+			var item interface{}
+			if i < len(arr) {
+				item = arr[i]
+			}
+			if item, err = jsonObjects(dec, item); err != nil {
+				return nil, err
+			}
+			if i < len(arr) {
+				arr[i] = item
+			}
+		}
+		_, err = dec.Token() // ']'
+		return arr, err
+	}
+	return v, nil
+}
+
+// deepCopy returns a copy of a JSON value, preserving the order of keys.
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case *object:
+		obj := newObject(v.Len())
+		for k, value := range v.All() {
+			obj.Set(k, deepCopy(value))
+		}
+		return obj
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, value := range v {
+			arr[i] = deepCopy(value)
+		}
+		return arr
+	default:
+		return v
+	}
+}
+
+// appendJSON appends the compact JSON encoding of v to buf, with the keys of
+// objects in order.
+func appendJSON(buf []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case *object:
+		buf = append(buf, '{')
+		for i, k := range v.Keys() {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			b, err := json.Marshal(k)
+			if err != nil {
+				return nil, err
+			}
+			buf = append(append(buf, b...), ':')
+			value, _ := v.Get(k)
+			if buf, err = appendJSON(buf, value); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, '}'), nil
+	case []interface{}:
+		buf = append(buf, '[')
+		for i, item := range v {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			var err error
+			if buf, err = appendJSON(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return append(buf, ']'), nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return append(buf, b...), nil
+	}
+}
+
+// yamlNode builds the YAML node of v, with the keys of objects in order.
+func yamlNode(v interface{}) (*yaml.Node, error) {
+	switch v := v.(type) {
+	case *object:
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for k, value := range v.All() {
+			key, err := yamlNode(k)
+			if err != nil {
+				return nil, err
+			}
+			valueNode, err := yamlNode(value)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, key, valueNode)
+		}
+		return n, nil
+	case []interface{}:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			value, err := yamlNode(item)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, value)
+		}
+		return n, nil
+	case json.Number:
+		// Keep the number as written (yaml.v3 would convert it to float64).
+		// A JSON number is also a number in YAML, so no tag is needed.
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: string(v)}, nil
+	default:
+		var n yaml.Node
+		if err := n.Encode(v); err != nil {
+			return nil, err
+		}
+		return &n, nil
+	}
+}
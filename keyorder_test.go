@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyOrderLoad(t *testing.T) {
+	for _, tc := range []struct {
+		name, input string
+	}{
+		{"yaml", "z: 1\na:\n  y: [{c: 1, b: 2}]\n  x: 2\nm: 3\n"},
+		{"json", `{"z":1,"a":{"y":[{"c":1,"b":2}],"x":2},"m":3}`},
+		{"jsonc", "{\"z\":1, /* a */ \"a\":{\"y\":[{\"c\":1,\"b\":2,},],\"x\":2},\"m\":3,}"},
+	} {
+		doc, err := loadReader(strings.NewReader(tc.input), tc.name, 0, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		b, err := appendJSON(nil, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("%s: %s", tc.name, b)
+		assertString(t, string(b), `{"z":1,"a":{"y":[{"c":1,"b":2}],"x":2},"m":3}`)
+	}
+
+	// Merge keys of YAML
+	doc, err := loadYAML(strings.NewReader("base: &base\n  z: 1\n  a: 2\nuse:\n  m: 0\n  <<: *base\n  b: 3\n"), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := appendJSON(nil, doc)
+	assertString(t, string(b), `{"base":{"z":1,"a":2},"use":{"m":0,"z":1,"a":2,"b":3}}`)
+
+	// Copy
+	b, _ = appendJSON(nil, deepCopy(doc))
+	assertString(t, string(b), `{"base":{"z":1,"a":2},"use":{"m":0,"z":1,"a":2,"b":3}}`)
+
+	// Keys added later come last, in the order of insertion
+	doc.Set("aa", true)
+	doc.Set("a", true)
+	doc.Delete("base")
+	b, _ = appendJSON(nil, doc)
+	assertString(t, string(b), `{"use":{"m":0,"z":1,"a":2,"b":3},"aa":true,"a":true}`)
+}
+
+func TestKeyOrderExpandRefs(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "input.yml"), []byte(`---
+swagger: "2.0"
+info:
+  title: API
+  $merge: common.yml#/info
+  version: "1.0"
+paths:
+  /z:
+    $inline: common.yml#/path
+    summary: Z
+    post:
+      responses:
+        "200":
+          description: OK
+  /a:
+    $ref: common.yml#/paths/~1a
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "common.yml"), []byte(`---
+info:
+  version: "0.0"
+  license:
+    name: MIT
+  contact:
+    name: Team
+path:
+  put:
+    responses:
+      "204":
+        description: Updated
+  get:
+    responses:
+      "200":
+        description: OK
+paths:
+  /a:
+    parameters: []
+    get:
+      responses:
+        default:
+          description: Error
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	encode, _ := newEncoder(&buf, "json", true)
+	err = processFile(filepath.Join(dir, "input.yml"), &loader{}, encode, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, buf.String(), `{"swagger":"2.0",`+
+		`"info":{"title":"API","license":{"name":"MIT"},"contact":{"name":"Team"},"version":"1.0"},`+
+		`"paths":{"/z":{"put":{"responses":{"204":{"description":"Updated"}}},"get":{"responses":{"200":{"description":"OK"}}},"summary":"Z","post":{"responses":{"200":{"description":"OK"}}}},`+
+		`"/a":{"parameters":[],"get":{"responses":{"default":{"description":"Error"}}}}}}`+"\n")
+}
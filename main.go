@@ -6,14 +6,44 @@ openapi-preprocessor process keywords in an extended version of an OpenAPI speci
 
 # Synopsis
 
-	openapi-preprocessor [-c] [-compact-output] [-debug=trace] <spec[.yaml|.json]>
+	openapi-preprocessor [-c] [-compact-output] [-format=json|yaml] [-canonical] [-digest=sha256|sha512] [-o <file> [-M <depfile>]] [-source-map <file>] [-group-by=tag|path] [-bundle] [-dereference [-keep-cycles]] [-debug=trace] [-warn-numbers] [-interpolate] [-D <name>=<value>]... [-map=<prefix>=<target>]... <spec[.yaml|.json]>
+
+	openapi-preprocessor [<option>...] [-input-format=yaml|json|jsonc] [-base=<dir>] -
+
+	openapi-preprocessor build [-config <file>] [-interpolate] [-D <name>=<value>]... [<target>...]
+
+	openapi-preprocessor split -o <dir> [-root <name>] <spec[.yaml|.json]>
 
 	openapi-preprocessor -version
 
 # Options
 
   - -c compact JSON output
+  - -format=json|yaml output format (default: yaml if the -o file has a .yaml or .yml extension, else json)
+  - -canonical canonical JSON output (RFC 8785 JSON Canonicalization Scheme): byte-stable, suitable for signing and caching
+  - -digest=sha256|sha512 compute the digest of the canonical JSON form of the result; written in sha256sum format to the file <file>.<algorithm> if -o is given, else to stderr
+  - -o <file> write the result to file instead of stdout; the file is replaced only on success, and left untouched if the content is unchanged
+  - -source-map <file> write a JSON object mapping each JSON pointer of the result to its origin: file, pointer and, for YAML sources, line and column
+  - -group-by=tag|path write one partial spec per tag, or per first path segment, to files named from the -o file (<file>-<group>.<ext>); each keeps only the operations of the group, the components they use, and the rest of the document, with the title suffixed by the group name; operations without tags (by tag) and the root path / (by path) are in no group
+  - -M <depfile> write a dependency file (Makefile syntax, like gcc -MD) listing every local document loaded to build the -o file
+  - -bundle hoist the targets of external $ref into the matching /components section (or /definitions, /parameters, /responses for Swagger 2.0) under a collision-free name, instead of injecting them at the same pointer
+  - -dereference replace every $ref with a copy of its target (after the removal of unused components)
+  - -keep-cycles with -dereference, keep circular $ref (recursive schemas) at the cycle point instead of failing
   - -debug=trace show trace of how the document is traversed
+  - -interpolate replace ${NAME} and ${NAME:-default} in string values with variables defined with -D or in the environment (use $${ for a literal ${)
+  - -D <name>=<value> define a variable for interpolation (repeatable, implies -interpolate)
+  - -warn-numbers warn about fields that must be strings (such as info.version) but were parsed as numbers (numbers are always written as in the source)
+  - -map=<prefix>=<target> rewrite links starting with prefix (a URL or a local path) to target (a local directory or URL) before loading (repeatable)
+  - -input-format=yaml|json|jsonc format of the document read from stdin (default: detected from content, as json or yaml: jsonc must be explicit)
+  - -base=<dir> directory (or http(s) URL) against which relative links of the document read from stdin are resolved (default: current directory)
+
+# Build
+
+The build subcommand builds the targets (all if none is given) described in the project config file (default: .openapi-preprocessor.yaml). Each target has an input, an output, a format (json, yaml or canonical), transforms (bundle, dereference, keep-cycles), filters (tags, exclude-tags, paths), variables and group-by (tag or path, like -group-by). Documents are parsed once for all targets. String values are interpolated (see -interpolate) if a target has variables, or with -interpolate or -D options given after build: their variables take precedence over the variables of the targets, and environment variables are used too.
+
+# Split
+
+The split subcommand writes each path item and each component of the spec to its own file in <dir>, with the same layout as a full spec, and the root document (named <name>, by default the name of the spec) with $ref links to those files. The preprocessing of the root document gives back the spec.
 
 # Preprocessor directives
 
@@ -28,12 +58,17 @@ See [full documentation] online.
 package main
 
 import (
-	"encoding/json"
+	"bufio"
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
@@ -75,6 +110,17 @@ func (dbg *debugFlags) Set(s string) error {
 	return nil
 }
 
+// options are the options of the processing of a spec.
+type options struct {
+	debug  debugFlags
+	bundle bool // hoist external $ref targets into components (see [BundleRefs])
+
+	dereference bool // replace every $ref with a copy of its target (see [Dereference])
+	keepCycles  bool // with dereference, keep circular $ref instead of failing
+
+	filters *filters // if not nil, remove the operations not selected (see [Filter])
+}
+
 func main() {
 	code, err := _main()
 	if err != nil {
@@ -90,14 +136,51 @@ func _main() (int, error) {
 	log.SetPrefix("")
 	log.SetFlags(0)
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "split":
+			return splitMain(os.Args[2:])
+		case "build":
+			return buildMain(os.Args[2:])
+		}
+	}
+
 	var showVersion bool
 	flag.BoolVar(&showVersion, "version", false, "show program version")
-	var debug debugFlags
-	flag.Var(&debug, "debug", "debug flags comma separated (trace=trace document navigation)")
+	var opts options
+	flag.Var(&opts.debug, "debug", "debug flags comma separated (trace=trace document navigation)")
+	flag.BoolVar(&opts.dereference, "dereference", false, "replace every $ref with a copy of its target")
+	flag.BoolVar(&opts.keepCycles, "keep-cycles", false, "with -dereference, keep circular $ref (recursive schemas) instead of failing")
+	flag.BoolVar(&opts.bundle, "bundle", false, "hoist the targets of external $ref into /components (or /definitions) instead of injecting them at the same pointer")
 
 	var compactJSON bool
 	flag.BoolVar(&compactJSON, "c", false, "compact JSON output")
 	flag.BoolVar(&compactJSON, "compact-output", false, "compact JSON output")
+
+	var format, output string
+	flag.StringVar(&format, "format", "", "output format: json or yaml (default: from the extension of the -o file, else json)")
+	flag.StringVar(&output, "o", "", "write the result to `file` (replaced only on success and if the content changed)")
+	var warnNumbersFlag bool
+	flag.BoolVar(&warnNumbersFlag, "warn-numbers", false, "warn about fields that must be strings (such as info.version) but were parsed as numbers")
+	var canonical bool
+	flag.BoolVar(&canonical, "canonical", false, "canonical JSON output (RFC 8785 JSON Canonicalization Scheme)")
+	var digest string
+	flag.StringVar(&digest, "digest", "", "compute the digest of the canonical JSON form of the result with `algorithm` (sha256 or sha512): written to the <-o file>.<algorithm> file, or to stderr")
+	var sourceMapName string
+	flag.StringVar(&sourceMapName, "source-map", "", "write to `file` a JSON object mapping each JSON pointer of the result to its origin (file, pointer, line, column)")
+	var groupBy string
+	flag.StringVar(&groupBy, "group-by", "", "write one partial spec per tag or per first path segment (`grouping`: tag or path), to files named from -o (<file>-<group>.<ext>); operations without tags (by tag) and the root path / (by path) are in no group")
+	var depFileName string
+	flag.StringVar(&depFileName, "M", "", "write to `depfile` the dependencies of the -o file (every document loaded) as a Makefile rule")
+
+	var inputFormat, baseDir string
+	flag.StringVar(&inputFormat, "input-format", "", "format of the document read from stdin: yaml, json or jsonc (default: detected from content, as json or yaml)")
+	flag.StringVar(&baseDir, "base", "", "base directory (or URL) for relative links of the document read from stdin (default: current directory)")
+
+	var ld loader
+	flag.BoolVar(&ld.interpolate, "interpolate", false, "interpolate ${VAR} in string values from -D and environment variables")
+	flag.Func("D", "define a `name=value` variable for ${name} interpolation (repeatable, implies -interpolate)", ld.Define)
+	flag.Func("map", "rewrite links starting with `prefix=target` (target is a local directory or URL, repeatable)", ld.AddMapping)
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [<option>...] <file>\nOptions:\n", os.Args[0])
 		flag.PrintDefaults()
@@ -115,29 +198,205 @@ func _main() (int, error) {
 		flag.Usage()
 	}
 
-	enc := json.NewEncoder(os.Stdout)
-	if !compactJSON {
-		enc.SetIndent("", "  ")
+	if depFileName != "" && output == "" {
+		return 2, errors.New("-M requires -o")
 	}
 
-	return 0, processFile(flag.Arg(0), enc.Encode, &debug)
+	if groupBy != "" {
+		switch {
+		case groupBy != "tag" && groupBy != "path":
+			return 2, fmt.Errorf("-group-by: %q: expected tag or path", groupBy)
+		case output == "":
+			return 2, errors.New("-group-by requires -o")
+		case depFileName != "", digest != "", sourceMapName != "":
+			return 2, errors.New("-group-by is incompatible with -M, -digest and -source-map")
+		}
+	}
+
+	if digest != "" {
+		if _, ok := digests[digest]; !ok {
+			return 2, fmt.Errorf("-digest: %q: unsupported algorithm", digest)
+		}
+	}
+	if canonical {
+		if format != "" && format != "json" {
+			return 2, fmt.Errorf("-canonical is incompatible with -format=%s", format)
+		}
+		format = "canonical"
+	}
+	if format == "" && output != "" {
+		format = outputFormat(output)
+	}
+	if sourceMapName != "" || warnNumbersFlag {
+		// Origins of the nodes are recorded only for the options that report them
+		ld.sources = new(sources)
+	}
+	var w io.Writer = os.Stdout
+	var buf bytes.Buffer
+	if output != "" {
+		w = &buf
+	}
+	encode, err := newEncoder(w, format, compactJSON)
+	if err != nil {
+		return 2, err
+	}
+	if warnNumbersFlag {
+		enc := encode
+		encode = func(doc interface{}) error {
+			warnNumbers(doc, ld.sources, ld.WorkDir(), func(msg string) {
+				fmt.Fprintln(os.Stderr, "warning:", msg)
+			})
+			return enc(doc)
+		}
+	}
+	var canonicalForm []byte
+	if digest != "" {
+		enc := encode
+		encode = func(doc interface{}) error {
+			if canonicalForm, err = appendCanonicalJSON(nil, doc); err != nil {
+				return err
+			}
+			return enc(doc)
+		}
+	}
+	var srcMap *object
+	if sourceMapName != "" {
+		enc := encode
+		encode = func(doc interface{}) error {
+			srcMap = sourceMap(doc, ld.sources, ld.WorkDir())
+			return enc(doc)
+		}
+	}
+
+	if groupBy != "" {
+		encode = func(doc interface{}) error {
+			return writeGroups(doc, groupBy, output, format, compactJSON)
+		}
+	}
+
+	if flag.Arg(0) == "-" {
+		err = processReader(os.Stdin, inputFormat, baseDir, &ld, encode, &opts)
+	} else {
+		err = processFile(flag.Arg(0), &ld, encode, &opts)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if srcMap != nil {
+		var b bytes.Buffer
+		if err = encodeJSON(&b, srcMap, compactJSON); err != nil {
+			return 0, err
+		}
+		if err = writeFile(sourceMapName, b.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	if groupBy != "" {
+		return 0, nil
+	}
+	if output == "" {
+		if canonicalForm != nil {
+			line, _ := digestLine(digest, canonicalForm, "-")
+			fmt.Fprint(os.Stderr, line)
+		}
+		return 0, nil
+	}
+	if err = writeFile(output, buf.Bytes()); err != nil {
+		return 0, err
+	}
+	if canonicalForm != nil {
+		line, _ := digestLine(digest, canonicalForm, filepath.Base(output))
+		if err = writeFile(output+"."+digest, []byte(line)); err != nil {
+			return 0, err
+		}
+	}
+	if depFileName != "" {
+		return 0, writeFile(depFileName, depFile(output, ld.Deps()))
+	}
+	return 0, nil
 }
 
-func processFile(pth string, encode func(interface{}) error, debug *debugFlags) error {
-	pth, err := filepath.Abs(pth)
+// processFile processes the document at arg, a path of the OS or, if ld has
+// a file system, a path in that file system.
+func processFile(arg string, ld *loader, encode func(interface{}) error, opts *options) error {
+	var pth string
+	if isRemote(arg) {
+		pth = arg
+	} else if ld.fsys != nil {
+		pth = path.Join("/", arg)
+	} else {
+		absPath, err := filepath.Abs(arg)
+		if err != nil {
+			return err
+		}
+		pth = filepath.ToSlash(absPath)
+	}
+
+	spec, err := ld.Load(pth)
 	if err != nil {
+		if _, isPathErr := err.(*fs.PathError); !isPathErr {
+			err = fmt.Errorf("%s: %v", arg, err)
+		}
 		return err
 	}
 
-	spec, err := loadFile(pth)
+	return processSpec(spec, pth, ld, encode, opts)
+}
+
+// stdinName is the name given to the document read from stdin.
+// It appears in error messages.
+const stdinName = "<stdin>"
+
+// processReader processes a document read from r (stdin). Relative links are
+// resolved against base (the current directory if empty).
+func processReader(r io.Reader, format string, base string, ld *loader, encode func(interface{}) error, opts *options) error {
+	var pth string
+	if isRemote(base) {
+		pth = strings.TrimSuffix(base, "/") + "/" + stdinName
+	} else if ld.fsys != nil {
+		pth = path.Join("/", base, stdinName)
+	} else {
+		if base == "" {
+			base = "."
+		}
+		absBase, err := filepath.Abs(base)
+		if err != nil {
+			return err
+		}
+		pth = filepath.ToSlash(filepath.Join(absBase, stdinName))
+	}
+
+	br := bufio.NewReader(r)
+	if format == "" {
+		format = detectFormat(br, "")
+	} else {
+		skipBOM(br)
+	}
+
+	var pos positions
+	if ld.sources != nil {
+		pos = make(positions)
+	}
+	spec, err := loadReader(br, format, 0, pos)
+	if err == nil {
+		ld.sources.addDoc(pth, spec, pos)
+		if err = ld.ExpandTags(spec, pth); err == nil {
+			err = ld.Interpolate(spec)
+		}
+	}
 	if err != nil {
-		return err
+		return fmt.Errorf("%s: %v", stdinName, err)
 	}
 
+	return processSpec(spec, pth, ld, encode, opts)
+}
+
+// processSpec processes spec which has been loaded from pth (slash separated).
+func processSpec(spec *object, pth string, ld *loader, encode func(interface{}) error, opts *options) error {
 	var tmp interface{} = spec
 
 	var trace func(string)
-	if debug.Trace {
+	if opts.debug.Trace {
 		buf := append(make([]byte, 0, 1024), "[TRACE] "...)
 		trace = func(s string) {
 			buf = append(append(buf, s...), '\n')
@@ -146,17 +405,32 @@ func processFile(pth string, encode func(interface{}) error, debug *debugFlags)
 		}
 	}
 
-	err = ExpandRefs(&tmp, &url.URL{
+	expandRefs := ExpandRefs
+	if opts.bundle {
+		expandRefs = BundleRefs
+	}
+	err := expandRefs(&tmp, &url.URL{
 		//Scheme: "file",
-		Path: filepath.ToSlash(pth),
-	}, trace)
+		Path: pth,
+	}, ld, trace)
 	if err != nil {
 		return err
 	}
 
-	for _, transform := range []func(*interface{}) error{
-		CleanUnused,
-	} {
+	var transforms []func(*interface{}) error
+	if opts.filters != nil {
+		transforms = append(transforms, func(rdoc *interface{}) error {
+			return Filter(rdoc, opts.filters)
+		})
+	}
+	transforms = append(transforms, CleanUnused)
+	if opts.dereference {
+		transforms = append(transforms, func(rdoc *interface{}) error {
+			return Dereference(rdoc, opts.keepCycles, ld.sources)
+		}, CleanUnused)
+	}
+
+	for _, transform := range transforms {
 		err = transform(&tmp)
 		if err != nil {
 			return err
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"iter"
+	"slices"
+	"sort"
+	"strconv"
+
+	"github.com/dolmen-go/jsonptr"
+)
+
+// object is a JSON object that keeps the order of its keys: the order of the
+// source document, then the order of insertion.
+//
+// The zero value is an empty object ready to use. Methods that don't modify
+// the object also accept a nil *object.
+type object struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// newObject returns an empty object with room for n keys.
+func newObject(n int) *object {
+	return &object{
+		keys:   make([]string, 0, n),
+		values: make(map[string]interface{}, n),
+	}
+}
+
+// Len returns the number of keys.
+func (obj *object) Len() int {
+	if obj == nil {
+		return 0
+	}
+	return len(obj.keys)
+}
+
+// Get returns the value of key.
+func (obj *object) Get(key string) (value interface{}, ok bool) {
+	if obj == nil {
+		return nil, false
+	}
+	value, ok = obj.values[key]
+	return
+}
+
+// Set sets the value of key. A new key comes after the existing ones.
+func (obj *object) Set(key string, value interface{}) {
+	if obj.values == nil {
+		obj.values = make(map[string]interface{})
+	}
+	if _, exists := obj.values[key]; !exists {
+		obj.keys = append(obj.keys, key)
+	}
+	obj.values[key] = value
+}
+
+// Delete removes key.
+func (obj *object) Delete(key string) {
+	if _, exists := obj.Get(key); !exists {
+		return
+	}
+	delete(obj.values, key)
+	i := slices.Index(obj.keys, key)
+	// Don't modify the slice returned by Keys (which may be iterated)
+	obj.keys = append(obj.keys[:i:i], obj.keys[i+1:]...)
+}
+
+// Keys returns the keys in order. The slice must not be modified.
+func (obj *object) Keys() []string {
+	if obj == nil {
+		return nil
+	}
+	return obj.keys
+}
+
+// SortedKeys returns the keys in alphabetical order.
+func (obj *object) SortedKeys() []string {
+	keys := slices.Clone(obj.Keys())
+	sort.Strings(keys)
+	return keys
+}
+
+// All iterates over keys and values in order.
+func (obj *object) All() iter.Seq2[string, interface{}] {
+	return func(yield func(string, interface{}) bool) {
+		for _, k := range obj.Keys() {
+			if !yield(k, obj.values[k]) {
+				return
+			}
+		}
+	}
+}
+
+// Reorder moves keys (those that exist) first, in the given order. The other
+// keys follow in their current order.
+func (obj *object) Reorder(keys []string) {
+	order := make([]string, 0, obj.Len())
+	seen := make(map[string]bool, obj.Len())
+	for _, k := range slices.Concat(keys, obj.Keys()) {
+		if _, exists := obj.Get(k); exists && !seen[k] {
+			order = append(order, k)
+			seen[k] = true
+		}
+	}
+	if obj != nil {
+		obj.keys = order
+	}
+}
+
+// MarshalJSON implements [encoding/json.Marshaler], keeping the order of keys.
+func (obj *object) MarshalJSON() ([]byte, error) {
+	return appendJSON(nil, obj)
+}
+
+// toObjects replaces the maps in v with objects with keys in alphabetical order.
+func toObjects(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		obj := newObject(len(v))
+		for _, k := range sortedKeys(v) {
+			obj.Set(k, toObjects(v[k]))
+		}
+		return obj
+	case []interface{}:
+		for i, item := range v {
+			v[i] = toObjects(item)
+		}
+	}
+	return v
+}
+
+// getPointer returns the value at ptr in doc, like [jsonptr.Get] for
+// documents made of objects.
+func getPointer(doc interface{}, ptr string) (interface{}, error) {
+	p, err := jsonptr.Parse(ptr)
+	if err != nil {
+		return nil, err
+	}
+	return getIn(doc, p)
+}
+
+func getIn(doc interface{}, ptr jsonptr.Pointer) (interface{}, error) {
+	for i, key := range ptr {
+		switch here := doc.(type) {
+		case *object:
+			var ok bool
+			if doc, ok = here.Get(key); !ok {
+				return nil, &jsonptr.PtrError{Ptr: ptr[:i+1].String(), Err: jsonptr.ErrProperty}
+			}
+		case []interface{}:
+			n, ok := arrayIndex(key)
+			if !ok || n >= len(here) {
+				return nil, &jsonptr.PtrError{Ptr: ptr[:i+1].String(), Err: jsonptr.ErrIndex}
+			}
+			doc = here[n]
+		default:
+			return nil, docError(ptr[:i].String(), doc)
+		}
+	}
+	return doc, nil
+}
+
+// setPointer sets the value at ptr in *pdoc, like [jsonptr.Set] for documents
+// made of objects. "-" (or the length) as the last array index appends.
+func setPointer(pdoc *interface{}, ptr string, value interface{}) error {
+	p, err := jsonptr.Parse(ptr)
+	if err != nil {
+		return err
+	}
+	if len(p) == 0 {
+		*pdoc = value
+		return nil
+	}
+	parentPtr, key := p[:len(p)-1], p[len(p)-1]
+	parent, err := getIn(*pdoc, parentPtr)
+	if err != nil {
+		return err
+	}
+	switch parent := parent.(type) {
+	case *object:
+		parent.Set(key, value)
+	case []interface{}:
+		n, ok := len(parent), key == "-"
+		if !ok {
+			n, ok = arrayIndex(key)
+		}
+		switch {
+		case !ok || n > len(parent):
+			return &jsonptr.PtrError{Ptr: ptr, Err: jsonptr.ErrIndex}
+		case n < len(parent):
+			parent[n] = value
+		default:
+			return setPointer(pdoc, parentPtr.String(), append(parent, value))
+		}
+	default:
+		return docError(parentPtr.String(), parent)
+	}
+	return nil
+}
+
+// deletePointer removes the value at ptr in *pdoc, like [jsonptr.Delete] for
+// documents made of objects.
+func deletePointer(pdoc *interface{}, ptr string) (interface{}, error) {
+	p, err := jsonptr.Parse(ptr)
+	if err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, &jsonptr.BadPointerError{BadPtr: ptr, Err: jsonptr.ErrDeleteRoot}
+	}
+	parentPtr, key := p[:len(p)-1], p[len(p)-1]
+	parent, err := getIn(*pdoc, parentPtr)
+	if err != nil {
+		return nil, err
+	}
+	switch parent := parent.(type) {
+	case *object:
+		v, found := parent.Get(key)
+		if !found {
+			return nil, &jsonptr.PtrError{Ptr: ptr, Err: jsonptr.ErrProperty}
+		}
+		parent.Delete(key)
+		return v, nil
+	case []interface{}:
+		n, ok := arrayIndex(key)
+		if !ok || n >= len(parent) {
+			return nil, &jsonptr.PtrError{Ptr: ptr, Err: jsonptr.ErrIndex}
+		}
+		v := parent[n]
+		return v, setPointer(pdoc, parentPtr.String(), slices.Delete(slices.Clone(parent), n, n+1))
+	default:
+		return nil, docError(parentPtr.String(), parent)
+	}
+}
+
+// arrayIndex parses an array index of a JSON pointer.
+func arrayIndex(key string) (int, bool) {
+	n, err := strconv.Atoi(key)
+	if err != nil || n < 0 || strconv.Itoa(n) != key {
+		return 0, false
+	}
+	return n, true
+}
+
+func docError(ptr string, doc interface{}) error {
+	return &jsonptr.DocumentError{Ptr: ptr, Err: fmt.Errorf("%q: not an object or array but %T", ptr, doc)}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dolmen-go/jsonptr"
+)
+
+// equalJSON returns true if a and b hold the same JSON values. Objects (as
+// *object or map[string]interface{}) are compared without regard to the
+// order of their keys.
+func equalJSON(a, b interface{}) bool {
+	props := func(v interface{}) (map[string]interface{}, bool) {
+		switch v := v.(type) {
+		case *object:
+			m := make(map[string]interface{}, v.Len())
+			for k, value := range v.All() {
+				m[k] = value
+			}
+			return m, true
+		case map[string]interface{}:
+			return v, true
+		}
+		return nil, false
+	}
+	if ma, isObj := props(a); isObj {
+		mb, isObj := props(b)
+		if !isObj || len(ma) != len(mb) {
+			return false
+		}
+		for k, va := range ma {
+			if vb, exists := mb[k]; !exists || !equalJSON(va, vb) {
+				return false
+			}
+		}
+		return true
+	}
+	if arrA, isArray := a.([]interface{}); isArray {
+		arrB, isArray := b.([]interface{})
+		if !isArray || len(arrA) != len(arrB) {
+			return false
+		}
+		for i := range arrA {
+			if !equalJSON(arrA[i], arrB[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func TestObject(t *testing.T) {
+	var obj object
+	obj.Set("z", 1)
+	obj.Set("a", 2)
+	obj.Set("m", 3)
+	obj.Set("a", 4) // keeps its position
+	assertString(t, strings.Join(obj.Keys(), ","), "z,a,m")
+	if v, ok := obj.Get("a"); !ok || v != 4 {
+		t.Errorf("a: got %v", v)
+	}
+	assertString(t, strings.Join(obj.SortedKeys(), ","), "a,m,z")
+
+	keys := obj.Keys()
+	obj.Delete("z")
+	obj.Delete("none")
+	assertString(t, strings.Join(obj.Keys(), ","), "a,m")
+	// The slice returned before is unchanged
+	assertString(t, strings.Join(keys, ","), "z,a,m")
+
+	obj.Set("b", 5)
+	obj.Reorder([]string{"b", "none", "m"})
+	assertString(t, strings.Join(obj.Keys(), ","), "b,m,a")
+
+	var null *object
+	if null.Len() != 0 || null.Keys() != nil {
+		t.Error("nil object not empty")
+	}
+	if _, ok := null.Get("a"); ok {
+		t.Error("nil object has a key")
+	}
+
+	b, _ := appendJSON(nil, toObjects(map[string]interface{}{"b": []interface{}{map[string]interface{}{"y": 1, "x": 2}}, "a": true}))
+	assertString(t, string(b), `{"a":true,"b":[{"x":2,"y":1}]}`)
+}
+
+func TestPointer(t *testing.T) {
+	var doc interface{} = toObjects(map[string]interface{}{
+		"a": map[string]interface{}{"b/c": []interface{}{"x", "y"}},
+	})
+
+	v, err := getPointer(doc, "/a/b~1c/1")
+	if err != nil || v != "y" {
+		t.Errorf("get: got %v, %v", v, err)
+	}
+	for ptr, expected := range map[string]error{
+		"/b":         jsonptr.ErrProperty,
+		"/a/b~1c/2":  jsonptr.ErrIndex,
+		"/a/b~1c/01": jsonptr.ErrIndex,
+		"a":          jsonptr.ErrSyntax,
+	} {
+		if _, err = getPointer(doc, ptr); !errors.Is(err, expected) {
+			t.Errorf("%q: got %v, expected %v", ptr, err, expected)
+		}
+	}
+	if _, err = getPointer(doc, "/a/b~1c/0/d"); err == nil {
+		t.Error("error expected inside a string")
+	} else {
+		assertString(t, err.Error(), `"/a/b~1c/0": not an object or array but string`)
+	}
+
+	for _, op := range []struct{ ptr, value string }{
+		{"/a/b~1c/0", "X"},
+		{"/a/b~1c/-", "z"},
+		{"/a/b~1c/3", "t"},
+		{"/a/new", "n"},
+	} {
+		if err = setPointer(&doc, op.ptr, op.value); err != nil {
+			t.Errorf("%q: %v", op.ptr, err)
+		}
+	}
+	if err = setPointer(&doc, "/a/b~1c/9", "?"); !errors.Is(err, jsonptr.ErrIndex) {
+		t.Errorf("got %v", err)
+	}
+	b, _ := appendJSON(nil, doc)
+	assertString(t, string(b), `{"a":{"b/c":["X","y","z","t"],"new":"n"}}`)
+
+	arr, _ := getPointer(doc, "/a/b~1c")
+	if v, err = deletePointer(&doc, "/a/b~1c/1"); err != nil || v != "y" {
+		t.Errorf("delete: got %v, %v", v, err)
+	}
+	if v, err = deletePointer(&doc, "/a/new"); err != nil || v != "n" {
+		t.Errorf("delete: got %v, %v", v, err)
+	}
+	if _, err = deletePointer(&doc, "/a/new"); !errors.Is(err, jsonptr.ErrProperty) {
+		t.Errorf("got %v", err)
+	}
+	if _, err = deletePointer(&doc, ""); !errors.Is(err, jsonptr.ErrDeleteRoot) {
+		t.Errorf("got %v", err)
+	}
+	b, _ = appendJSON(nil, doc)
+	assertString(t, string(b), `{"a":{"b/c":["X","z","t"]}}`)
+	// The array is not modified in place
+	b, _ = appendJSON(nil, arr)
+	assertString(t, string(b), `["X","y","z","t"]`)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// newEncoder returns a function that writes a document to w in the given
+// format: "json" (indented unless compact), "yaml" or "canonical" (RFC 8785).
+// Except in canonical form, keys of objects are written in the order of the
+// source documents.
+func newEncoder(w io.Writer, format string, compact bool) (func(interface{}) error, error) {
+	switch format {
+	case "", "json":
+		return func(doc interface{}) error {
+			return encodeJSON(w, doc, compact)
+		}, nil
+	case "yaml":
+		return func(doc interface{}) error {
+			return encodeYAML(w, doc)
+		}, nil
+	case "canonical":
+		return func(doc interface{}) error {
+			b, err := appendCanonicalJSON(nil, doc)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(b)
+			return err
+		}, nil
+	default:
+		return nil, fmt.Errorf("%q: unknown output format", format)
+	}
+}
+
+// encodeJSON writes doc to w as JSON, indented unless compact.
+func encodeJSON(w io.Writer, doc interface{}, compact bool) error {
+	b, err := appendJSON(nil, doc)
+	if err != nil {
+		return err
+	}
+	if !compact {
+		var buf bytes.Buffer
+		buf.Grow(len(b) * 2)
+		if err = json.Indent(&buf, b, "", "  "); err != nil {
+			return err
+		}
+		b = buf.Bytes()
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// encodeYAML writes doc to w as block style YAML. Strings that would be
+// resolved as another type (such as "404", "1.0" or "true") are quoted.
+func encodeYAML(w io.Writer, doc interface{}) error {
+	n, err := yamlNode(doc)
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(n); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// outputFormat returns the output format implied by the extension of the
+// output file: "yaml" for .yaml and .yml, "json" otherwise.
+func outputFormat(output string) string {
+	switch strings.ToLower(filepath.Ext(output)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	default:
+		return "json"
+	}
+}
+
+// writeFile writes data to the file name through a temporary file renamed
+// into place, so the file is never left truncated. If the file already has
+// the same content it is left untouched (its modification time doesn't change).
+// An existing file keeps its permissions; a new file gets the permissions of
+// [os.Create].
+func writeFile(name string, data []byte) (err error) {
+	perm := fs.FileMode(0o666) // as os.Create: filtered by the umask
+	keepPerm := false
+	if fi, err := os.Stat(name); err == nil {
+		if fi.Size() == int64(len(data)) {
+			if current, err := os.ReadFile(name); err == nil && bytes.Equal(current, data) {
+				return nil
+			}
+		}
+		perm, keepPerm = fi.Mode().Perm(), true
+	}
+
+	f, err := createTemp(filepath.Dir(name), "."+filepath.Base(name)+".", perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+	if keepPerm {
+		// The umask applied at creation might have dropped some bits
+		if err = f.Chmod(perm); err != nil {
+			return err
+		}
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// createTemp creates a new file in dir with a random name starting with
+// prefix, like [os.CreateTemp], but with permissions perm (before umask).
+func createTemp(dir string, prefix string, perm fs.FileMode) (*os.File, error) {
+	for {
+		f, err := os.OpenFile(filepath.Join(dir, prefix+strconv.FormatUint(rand.Uint64(), 36)), os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+// makeEscaper escapes file names for Makefile (and ninja) rules.
+var makeEscaper = strings.NewReplacer(" ", "\\ ", "#", "\\#", "$", "$$")
+
+// depFile returns the content of a dependency file (Makefile syntax, like
+// gcc -MD) stating that target depends on deps.
+func depFile(target string, deps []string) []byte {
+	var b bytes.Buffer
+	b.WriteString(makeEscaper.Replace(target))
+	b.WriteByte(':')
+	for _, dep := range deps {
+		b.WriteByte(' ')
+		b.WriteString(makeEscaper.Replace(dep))
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+// digests are the hash functions available for -digest.
+var digests = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// digestLine returns the digest of data using algorithm in the format of
+// sha256sum (name is the file name of data).
+func digestLine(algorithm string, data []byte, name string) (string, error) {
+	newHash, ok := digests[algorithm]
+	if !ok {
+		return "", fmt.Errorf("%q: unsupported digest algorithm", algorithm)
+	}
+	h := newHash()
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)) + "  " + name + "\n", nil
+}
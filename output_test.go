@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeYAML(t *testing.T) {
+	doc := toObjects(map[string]interface{}{
+		"info": map[string]interface{}{
+			"version":     "1.0",
+			"description": "Line 1\nLine 2",
+		},
+		"strings": []interface{}{"404", "1.0", "true", "yes", "null", "~", "", "0x1F", "1e3", "#", "- x", "a: b"},
+		"values":  []interface{}{json.Number("404"), json.Number("1.50"), json.Number("-1e+30"), true, nil},
+	})
+	var buf bytes.Buffer
+	if err := encodeYAML(&buf, doc); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("%s", buf.String())
+	if strings.Contains(buf.String(), "{") {
+		t.Error("block style expected")
+	}
+
+	back, err := loadYAML(&buf, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalJSON(back, doc) {
+		t.Errorf("round trip failed: %#v", back)
+	}
+}
+
+func TestNewEncoder(t *testing.T) {
+	for _, tc := range []struct {
+		format  string
+		compact bool
+		out     string
+	}{
+		{"json", false, "{\n  \"a\": \"1\"\n}\n"},
+		{"json", true, "{\"a\":\"1\"}\n"},
+		{"yaml", false, "a: \"1\"\n"},
+	} {
+		var buf bytes.Buffer
+		encode, err := newEncoder(&buf, tc.format, tc.compact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = encode(toObjects(map[string]interface{}{"a": "1"})); err != nil {
+			t.Fatal(err)
+		}
+		assertString(t, buf.String(), tc.out)
+	}
+
+	if _, err := newEncoder(nil, "xml", false); err == nil {
+		t.Error("error expected")
+	}
+}
+
+func TestOutputFormat(t *testing.T) {
+	assertString(t, outputFormat("api.yaml"), "yaml")
+	assertString(t, outputFormat("dir/api.YML"), "yaml")
+	assertString(t, outputFormat("api.json"), "json")
+	assertString(t, outputFormat("api"), "json")
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "out.json")
+
+	if err := writeFile(name, []byte("{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(name, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(name, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unchanged content: the file is not touched
+	if err := writeFile(name, []byte("{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(past) {
+		t.Errorf("modification time changed: %v", fi.ModTime())
+	}
+
+	// Changed content: the file is replaced, keeping its permissions
+	if err := writeFile(name, []byte("[]\n")); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, string(b), "[]\n")
+	if fi, err = os.Stat(name); err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("permissions: got %v", fi.Mode().Perm())
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary file left: %v", entries)
+	}
+
+	// New file: same permissions as os.Create (umask applied)
+	f, err := os.Create(filepath.Join(dir, "ref.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	ref, err := os.Stat(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeFile(filepath.Join(dir, "new.json"), []byte("{}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err = os.Stat(filepath.Join(dir, "new.json")); err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != ref.Mode().Perm() {
+		t.Errorf("permissions of new file: got %v, expected %v", fi.Mode().Perm(), ref.Mode().Perm())
+	}
+
+	if err := writeFile(filepath.Join(dir, "missing", "out.json"), []byte("{}\n")); err == nil {
+		t.Error("error expected")
+	}
+}
+
+func TestDepFile(t *testing.T) {
+	assertString(t, string(depFile("out.json", []string{"api/openapi.yaml", "my dir/a#1.yml", "$x.yml"})),
+		"out.json: api/openapi.yaml my\\ dir/a\\#1.yml $$x.yml\n")
+}
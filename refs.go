@@ -1,17 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"net/url"
-	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
-	"github.com/mohae/deepcopy"
-
 	"github.com/dolmen-go/jsonptr"
 )
 
@@ -28,22 +27,23 @@ func skipRef(ptr jsonptr.Pointer) bool {
 func visitRefs(root interface{}, ptr jsonptr.Pointer, visitor func(jsonptr.Pointer, string) (string, error)) (err error) {
 	//log.Println(ptr)
 	switch root := root.(type) {
-	case map[string]interface{}:
-		if len(root) == 0 {
+	case *object:
+		if root.Len() == 0 {
 			break
 		}
 		ptr.Grow(1)
-		for _, k := range sortedKeys(root) {
+		for _, k := range root.SortedKeys() {
 			ptr.Property(k)
+			v, _ := root.Get(k)
 			if k == "$ref" && !skipRef(ptr[:len(ptr)-1]) {
-				if str, isString := root[k].(string); isString {
-					root[k], err = visitor(ptr, str)
-					if err != nil {
+				if str, isString := v.(string); isString {
+					if str, err = visitor(ptr, str); err != nil {
 						return
 					}
+					root.Set(k, str)
 				}
 			} else {
-				err = visitRefs(root[k], ptr, visitor)
+				err = visitRefs(v, ptr, visitor)
 				if err != nil {
 					break
 				}
@@ -75,6 +75,12 @@ type loc struct {
 }
 
 func (l *loc) URL() *url.URL {
+	if isRemote(l.Path) {
+		if u, err := url.Parse(l.Path); err == nil {
+			u.Fragment = l.Ptr
+			return u
+		}
+	}
 	u := url.URL{
 		Path:     l.Path,
 		Fragment: l.Ptr,
@@ -117,6 +123,17 @@ func (l *loc) Index(i int) loc {
 }
 
 func (l *loc) Rel(basePath string) loc {
+	if isRemote(l.Path) {
+		return *l
+	}
+	if isGit(l.Path) {
+		rev, file, err := splitGit(l.Path)
+		if err != nil {
+			return *l
+		}
+		rel := (&loc{file, l.Ptr}).Rel(basePath)
+		return loc{gitPrefix + rev + ":" + rel.Path, l.Ptr}
+	}
 	// FIXME do not use FS dependent paths
 	rel, err := filepath.Rel(filepath.FromSlash(basePath), filepath.FromSlash(l.Path))
 	if err != nil {
@@ -136,11 +153,11 @@ type node struct {
 
 // IsRef returns true if the node is a $ref.
 func (n *node) IsRef() bool {
-	obj, isObj := n.data.(map[string]interface{})
+	obj, isObj := n.data.(*object)
 	if !isObj || obj == nil {
 		return false
 	}
-	link, isString := obj["$ref"].(string)
+	link, isString := stringProp(obj, "$ref")
 	if !isString {
 		return false
 	}
@@ -149,11 +166,11 @@ func (n *node) IsRef() bool {
 
 // Ref returns the link of a $ref node.
 func (n *node) Ref() string {
-	obj, isObj := n.data.(map[string]interface{})
+	obj, isObj := n.data.(*object)
 	if !isObj || obj == nil {
 		return ""
 	}
-	link, isString := obj["$ref"].(string)
+	link, isString := stringProp(obj, "$ref")
 	if !isString {
 		return ""
 	}
@@ -167,6 +184,9 @@ type refResolver struct {
 	visited  map[loc]bool
 	inject   map[string]string
 	inlining bool
+	bundle   *bundler // if not nil, external $ref targets are hoisted into components
+	loader   *loader
+	sources  *sources // records the copies of nodes
 	trace    func(string)
 }
 
@@ -200,7 +220,47 @@ func (resolver *refResolver) Tracef(msg string, args ...interface{}) {
 	resolver.trace(fmt.Sprintf(msg, args...))
 }
 
-func (resolver *refResolver) resolve(link string, relativeTo *loc) (*node, error) {
+// resolveLocation resolves the path part of a link relative to the location
+// of a document (base).
+func resolveLocation(base string, pth string) (string, error) {
+	if len(pth) == 0 {
+		return base, nil
+	}
+	if isGit(pth) || isGit(base) {
+		return resolveGitLocation(base, pth)
+	}
+	if isRemote(pth) || isRemote(base) {
+		// Remote links are kept as URLs (not unescaped)
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return "", fmt.Errorf("%q: %v", base, err)
+		}
+		u, err := url.Parse(pth)
+		if err != nil {
+			return "", fmt.Errorf("%q: %v", pth, err)
+		}
+		return baseURL.ResolveReference(u).String(), nil
+	}
+	tmpPath, err := url.PathUnescape(pth)
+	if err != nil {
+		return "", fmt.Errorf("%q: %v", pth, err)
+	}
+	if tmpPath[0] == '?' {
+		// Another document of the same YAML stream
+		if i := strings.LastIndex(base, "?doc="); i >= 0 {
+			base = base[:i]
+		}
+		return base + tmpPath, nil
+	}
+	return resolvePath(base, tmpPath), nil
+}
+
+// resolve resolves link found at relativeTo.
+//
+// A link to an ancestor of relativeTo in the same document is circular,
+// unless isRef is true: an internal $ref to an ancestor (a recursive schema)
+// is kept as is.
+func (resolver *refResolver) resolve(link string, relativeTo *loc, isRef bool) (*node, error) {
 	// log.Println(link, relativeTo)
 	var targetLoc loc
 	var ptr jsonptr.Pointer
@@ -217,26 +277,21 @@ func (resolver *refResolver) resolve(link string, relativeTo *loc) (*node, error
 		targetLoc.Path = link
 	}
 
-	if len(targetLoc.Path) > 0 {
-		tmpPath, err := url.PathUnescape(targetLoc.Path)
-		if err != nil {
-			return nil, fmt.Errorf("%q: %v", targetLoc.Path, err)
-		}
-		targetLoc.Path = resolvePath(relativeTo.Path, tmpPath)
-	} else {
-		targetLoc.Path = relativeTo.Path
+	targetLoc.Path, err = resolveLocation(relativeTo.Path, targetLoc.Path)
+	if err != nil {
+		return nil, err
 	}
 
 	// log.Println("=>", u)
 
-	if targetLoc.Path == relativeTo.Path && strings.HasPrefix(relativeTo.Ptr, targetLoc.Ptr+"/") {
+	if !isRef && targetLoc.Path == relativeTo.Path && strings.HasPrefix(relativeTo.Ptr, targetLoc.Ptr+"/") {
 		return nil, errors.New("circular link")
 	}
 
 	rdoc, loaded := resolver.docs[targetLoc.Path]
 	if !loaded {
 		//log.Println("Loading", &targetLoc)
-		doc, err := loadFile(filepath.FromSlash(targetLoc.Path))
+		doc, err := resolver.loader.Load(targetLoc.Path)
 		if err != nil {
 			return nil, fmt.Errorf("can't load %q: %v", targetLoc.Path, err)
 		}
@@ -253,7 +308,7 @@ func (resolver *refResolver) resolve(link string, relativeTo *loc) (*node, error
 
 	// FIXME we could reduce the number of evals of JSON pointers...
 
-	frag, err := ptr.In(*rdoc)
+	frag, err := getIn(*rdoc, ptr)
 	if err != nil {
 		// If the can't be immediately resolved, this may be because
 		// of a $inline in the way
@@ -261,16 +316,16 @@ func (resolver *refResolver) resolve(link string, relativeTo *loc) (*node, error
 		p := jsonptr.Pointer{}
 		for {
 			// log.Println(p)
-			doc, err := p.In(*rdoc)
+			doc, err := getIn(*rdoc, p)
 			if err != nil {
 				// Failed to resolve the fragment
 				return nil, err
 			}
-			if obj, isMap := doc.(map[string]interface{}); isMap {
-				if _, isInline := obj["$inline"]; isInline {
+			if obj, isObj := doc.(*object); isObj {
+				if _, isInline := obj.Get("$inline"); isInline {
 					//log.Printf("%#v", obj)
 					err := resolver.expand(node{obj, func(data interface{}) {
-						p.Set(rdoc, data)
+						setPointer(rdoc, p.String(), data)
 					}, loc{Path: targetLoc.Path, Ptr: p.String()}})
 					if err != nil {
 						return nil, err
@@ -284,11 +339,11 @@ func (resolver *refResolver) resolve(link string, relativeTo *loc) (*node, error
 			p = ptr[:len(p)+1]
 		}
 
-		frag, _ = ptr.In(*rdoc)
+		frag, _ = getIn(*rdoc, ptr)
 	}
 
 	return &node{frag, func(data interface{}) {
-		ptr.Set(rdoc, data)
+		setPointer(rdoc, ptr.String(), data)
 	}, targetLoc}, nil
 }
 
@@ -304,7 +359,7 @@ func (resolver *refResolver) expand(n node) error {
 	if doc, isSlice := n.data.([]interface{}); isSlice {
 		for i, v := range doc {
 			switch v.(type) {
-			case []interface{}, map[string]interface{}:
+			case []interface{}, *object:
 				err := resolver.expand(node{v, func(data interface{}) {
 					doc[i] = data
 				}, n.loc.Index(i)})
@@ -315,29 +370,32 @@ func (resolver *refResolver) expand(n node) error {
 		}
 		return nil
 	}
-	obj, isObject := n.data.(map[string]interface{})
+	obj, isObject := n.data.(*object)
 	if !isObject || obj == nil {
 		return nil
 	}
 
-	if ref, isRef := obj["$ref"]; isRef && !skipRef(jsonptr.MustParse(n.loc.Ptr)) {
+	if ref, isRef := obj.Get("$ref"); isRef && !skipRef(jsonptr.MustParse(n.loc.Ptr)) {
 		return resolver.expandTagRef(obj, n.set, &n.loc, ref)
 	}
 
 	// An extension to build an object from mixed local data and
 	// imported data
-	if refs, isMerge := obj["$merge"]; isMerge {
-		return resolver.expandTagMerge(obj, n.set, &n.loc, refs)
+	if refs, isMerge := obj.Get("$merge"); isMerge {
+		return resolver.expandTagMerge(obj, n.set, &n.loc, "$merge", refs)
+	}
+	if refs, isMerge := obj.Get("$deepMerge"); isMerge {
+		return resolver.expandTagMerge(obj, n.set, &n.loc, "$deepMerge", refs)
 	}
 
-	if ref, isInline := obj["$inline"]; isInline {
+	if ref, isInline := obj.Get("$inline"); isInline {
 		return resolver.expandTagInline(obj, n.set, &n.loc, ref)
 	}
 
-	keys := sortedKeys(obj)
+	keys := obj.SortedKeys()
 
 	expandFirst := func(prop string) error {
-		if obj, hasProp := objectProp(obj, prop); hasProp {
+		if _, hasProp := objectProp(obj, prop); hasProp {
 			if err := resolver.expandProperty(n.loc, obj, prop); err != nil {
 				return err
 			}
@@ -373,23 +431,28 @@ func (resolver *refResolver) expand(n node) error {
 	return nil
 }
 
-func (resolver *refResolver) expandProperty(parentLoc loc, obj map[string]interface{}, key string) error {
+func (resolver *refResolver) expandProperty(parentLoc loc, obj *object, key string) error {
 	//log.Println("Key:", key)
-	return resolver.expand(node{obj[key], func(data interface{}) {
-		obj[key] = data
+	value, _ := obj.Get(key)
+	return resolver.expand(node{value, func(data interface{}) {
+		obj.Set(key, data)
 	}, parentLoc.Property(key)})
 }
 
 // expandTagRef expands (follows) a $ref link.
-func (resolver *refResolver) expandTagRef(obj map[string]interface{}, set setter, l *loc, ref interface{}) error {
+func (resolver *refResolver) expandTagRef(obj *object, set setter, l *loc, ref interface{}) error {
 	resolver.Tracef("$ref: %s => %s", l, ref)
 	link, isString := ref.(string)
 	if !isString {
 		return resolver.Errorf(&loc{l.Path, l.Ptr + "/$ref"}, "must be a string")
 	}
+	if resolver.bundle != nil && resolver.bundle.done[*l] {
+		// Already rewritten
+		return nil
+	}
 
-	if len(obj) > 1 {
-		unexpected := len(obj) - 1 // Don't count $ref
+	if obj.Len() > 1 {
+		unexpected := obj.Len() - 1 // Don't count $ref
 		// http://spec.openapis.org/oas/v3.1.0#reference-object
 		if _, ok := stringProp(obj, "summary"); ok {
 			unexpected--
@@ -406,11 +469,18 @@ func (resolver *refResolver) expandTagRef(obj map[string]interface{}, set setter
 		}
 	}
 
-	target, err := resolver.resolveAndExpand(link, l)
+	target, err := resolver.resolveAndExpand(link, l, true)
 	if err != nil {
 		return err
 	}
-	if l.Ptr != target.loc.Ptr && strings.HasPrefix(l.Ptr+"/", target.loc.Ptr+"/") {
+	if resolver.bundle != nil && target.loc.Path != resolver.rootPath {
+		if ptr, ok := resolver.bundle.hoist(l, target, resolver.rootPath); ok {
+			obj.Set("$ref", "#"+ptr)
+			resolver.bundle.done[*l] = true
+			return nil
+		}
+	}
+	if target.loc.Path != l.Path && l.Ptr != target.loc.Ptr && strings.HasPrefix(l.Ptr+"/", target.loc.Ptr+"/") {
 		if target.loc.Ptr == "" {
 			return resolver.Errorf(l, "injection of %q at root will create a circular link (tip: use $inline)", target.loc.Path)
 		}
@@ -419,25 +489,27 @@ func (resolver *refResolver) expandTagRef(obj map[string]interface{}, set setter
 
 	if resolver.inject != nil {
 		if target.loc.Path != resolver.rootPath {
-			if src := resolver.inject[l.Ptr]; src != "" && src != target.loc.Path {
+			if src := resolver.inject[target.loc.Ptr]; src != "" && src != target.loc.Path {
 				// TODO we should also save l in resolver.inject to be able to signal the location
 				// of $ref that provoke the injection
 				return resolver.Errorf(l, "import fragment %q is imported from %q and %q", link, src, target.loc.Path)
 			}
-			resolver.inject[l.Ptr] = target.loc.Path
+			resolver.inject[target.loc.Ptr] = target.loc.Path
 		}
 	}
 
 	return nil
 }
 
-// expandTagMerge expands a $merge object.
-func (resolver *refResolver) expandTagMerge(obj map[string]interface{}, set setter, l *loc, refs interface{}) error {
-	resolver.Tracef("$merge at %s", l)
+// expandTagMerge expands a $merge object, or a $deepMerge object (keyword) which
+// merges objects recursively (see [deepMerge]).
+func (resolver *refResolver) expandTagMerge(obj *object, set setter, l *loc, keyword string, refs interface{}) error {
+	resolver.Tracef("%s at %s", keyword, l)
+	deep := keyword == "$deepMerge"
 	var links []string
 	switch refs := refs.(type) {
 	case string:
-		if len(obj) == 1 {
+		if obj.Len() == 1 {
 			return resolver.Errorf(l, "merging with nothing?")
 		}
 		links = []string{refs}
@@ -451,17 +523,25 @@ func (resolver *refResolver) expandTagMerge(obj map[string]interface{}, set sett
 			// Reverse order
 			links[len(links)-1-i] = lnk
 		}
-		if len(links) == 1 && len(obj) == 1 {
+		if len(links) == 1 && obj.Len() == 1 {
 			return resolver.Errorf(l, "merging with nothing? (tip: use $inline)")
 		}
 	default:
-		return resolver.Errorf(&loc{l.Path, l.Ptr + "/$merge"}, "must be a string or array of strings")
+		return resolver.Errorf(&loc{l.Path, l.Ptr + "/" + keyword}, "must be a string or array of strings")
+	}
+	// Keys before $merge stay before the imported keys
+	before := make(map[string]bool)
+	for _, k := range obj.Keys() {
+		if k == keyword {
+			break
+		}
+		before[k] = true
 	}
-	delete(obj, "$merge")
+	obj.Delete(keyword)
 
 	delete(resolver.visited, *l)
 	err := resolver.expand(node{obj, func(data interface{}) {
-		obj = data.(map[string]interface{})
+		obj = data.(*object)
 		set(data)
 	}, *l})
 	resolver.visited[*l] = true
@@ -472,37 +552,117 @@ func (resolver *refResolver) expandTagMerge(obj map[string]interface{}, set sett
 	// overrides := make(map[string]string)
 	// fill with (key => loc.Property(key))
 
+	localKeys := obj.Keys()
+	imported := make([]*object, len(links))
 	for i, link := range links {
-		target, err := resolver.resolveAndExpand(link, l)
+		target, err := resolver.resolveAndExpand(link, l, false)
 		if err != nil {
 			return err
 		}
 
-		objTarget, isObj := target.data.(map[string]interface{})
+		objTarget, isObj := target.data.(*object)
 		if !isObj {
 			if len(links) == 1 {
-				return resolver.Errorf(&loc{l.Path, l.Ptr + "/$merge"}, "link must point to object")
+				return resolver.Errorf(&loc{l.Path, l.Ptr + "/" + keyword}, "link must point to object")
 			}
-			return resolver.Errorf(&loc{l.Path, fmt.Sprintf("%s/$merge/%d", l.Ptr, i)}, "link must point to object")
+			return resolver.Errorf(&loc{l.Path, fmt.Sprintf("%s/%s/%d", l.Ptr, keyword, i)}, "link must point to object")
 		}
-		for k, v := range objTarget {
-			if _, exists := obj[k]; exists {
+		imported[i] = objTarget
+		for k, v := range objTarget.All() {
+			if local, exists := obj.Get(k); exists {
 				// TODO warn about overrides if verbose
 				// if o, overriden := overrides[k]; overriden {
 				//   log.Println("%s overrides %s", l.Property(k), target.loc.Property(k))
 				// }
+				if deep {
+					dst, src := l.Property(k), target.loc.Property(k)
+					deepMerge(local, v, func(ptr string) {
+						resolver.sources.copy(loc{dst.Path, dst.Ptr + ptr}, loc{src.Path, src.Ptr + ptr})
+					})
+				}
 				continue
 			}
-			obj[k] = v
+			if deep {
+				// Copy as it may be merged with the following links
+				v = deepCopy(v)
+			}
+			obj.Set(k, v)
+			resolver.sources.copy(l.Property(k), target.loc.Property(k))
 			// overrides[k] = link
 		}
 	}
 
+	// Imported keys take the place of $merge, in the order of the links
+	keys := make([]string, 0, obj.Len())
+	placed := make(map[string]bool, obj.Len())
+	for _, k := range localKeys {
+		placed[k] = true
+		if before[k] {
+			keys = append(keys, k)
+		}
+	}
+	for i := len(imported) - 1; i >= 0; i-- {
+		for _, k := range imported[i].Keys() {
+			if !placed[k] {
+				keys = append(keys, k)
+				placed[k] = true
+			}
+		}
+	}
+	for _, k := range localKeys {
+		if !before[k] {
+			keys = append(keys, k)
+		}
+	}
+	obj.Reorder(keys)
+
 	return nil
 }
 
+// deepMerge merges the object src into the object dst (of higher precedence),
+// recursively: for keys in both, the value of dst wins, unless both are objects
+// which are then merged. Arrays are not merged. Objects with $ref are not
+// merged either as $ref must be alone. Imported keys come first in the key
+// order of dst, in their own order. dst must not be shared.
+//
+// copied is called with the pointer (relative to dst and src) of each value
+// copied from src.
+//
+// deepMerge does nothing if dst and src are not both mergeable objects.
+func deepMerge(dst, src interface{}, copied func(ptr string)) {
+	mergeable := func(v interface{}) (*object, bool) {
+		obj, isObj := v.(*object)
+		if isObj {
+			_, isRef := obj.Get("$ref")
+			isObj = !isRef
+		}
+		return obj, isObj
+	}
+	dstObj, ok := mergeable(dst)
+	if !ok {
+		return
+	}
+	srcObj, ok := mergeable(src)
+	if !ok {
+		return
+	}
+
+	for k, v := range srcObj.All() {
+		ptr := "/" + jsonptr.EscapeString(k)
+		if local, exists := dstObj.Get(k); exists {
+			deepMerge(local, v, func(p string) {
+				copied(ptr + p)
+			})
+			continue
+		}
+		dstObj.Set(k, deepCopy(v))
+		copied(ptr)
+	}
+	dstObj.Reorder(srcObj.Keys())
+}
+
 // expandTagInline expands a $inline object.
-func (resolver *refResolver) expandTagInline(obj map[string]interface{}, set setter, l *loc, ref interface{}) error {
+func (resolver *refResolver) expandTagInline(obj *object, set setter, l *loc, ref interface{}) error {
 	resolver.Tracef("$inline: %s => %s", l, ref)
 	link, isString := ref.(string)
 	if !isString {
@@ -516,13 +676,13 @@ func (resolver *refResolver) expandTagInline(obj map[string]interface{}, set set
 	var err error
 	l2 := loc{l.Path, l.Ptr} // Clone
 	for {
-		target, err = resolver.resolveAndExpand(link, &l2)
+		target, err = resolver.resolveAndExpand(link, &l2, false)
 		if err != nil {
 			return err
 		}
 		// If target is not $ref, stop
 		link = target.Ref()
-		if link == "" || len(obj) == 1 {
+		if link == "" || obj.Len() == 1 {
 			break
 		}
 		/*
@@ -537,26 +697,42 @@ func (resolver *refResolver) expandTagInline(obj map[string]interface{}, set set
 
 	resolver.inlining = inlining
 
-	target.data = deepcopy.Copy(target.data)
+	target.data = deepCopy(target.data)
 	// Replace the original node (obj) with the copy of the target
 	set(target.data)
 	// obj is now disconnected from the original tree
 
 	//log.Printf("xxx %#v", target.data)
 
-	if len(obj) > 1 {
+	// The overrides keep their origin, over the origin of the copy of the target
+	type override struct {
+		ptr     string // relative to l
+		origins map[string]loc
+	}
+	var overrides []override
+
+	if obj.Len() > 1 {
 		switch targetX := target.data.(type) {
-		case map[string]interface{}:
+		case *object:
 			// To forbid raw '$' (because we have '$inline'), but still enable it
 			// in pointers, we use "~2" as a replacement as it is not a valid JSON Pointer
 			// sequence.
 			replDollar := strings.NewReplacer("~2", "$")
+			// New properties are appended in the order of the overrides
+			keys := slices.Clone(targetX.Keys())
+			for _, k := range obj.Keys() {
+				if len(k) > 0 && k[0] != '$' && !strings.ContainsAny(k, "/") {
+					if prop, err := jsonptr.UnescapeString(replDollar.Replace(k)); err == nil && !slices.Contains(keys, prop) {
+						keys = append(keys, prop)
+					}
+				}
+			}
 			var prefixes []string
-			for _, k := range sortedKeys(obj) {
+			for _, k := range obj.SortedKeys() {
 				if len(k) > 0 && k[0] == '$' { // skip $inline
 					continue
 				}
-				v := obj[k]
+				v, _ := obj.Get(k)
 				//log.Println(k)
 				err = resolver.expand(node{v, func(data interface{}) {
 					v = data
@@ -570,7 +746,8 @@ func (resolver *refResolver) expandTagInline(obj map[string]interface{}, set set
 					if err != nil {
 						return resolver.Errorf(l, "%q: %v", k, err)
 					}
-					targetX[prop] = v
+					targetX.Set(prop, v)
+					overrides = append(overrides, override{"/" + jsonptr.EscapeString(prop), resolver.sources.originsOf(l.Property(k))})
 					prefixes = append(prefixes[:0], ptr)
 				} else {
 					// If patching a previous patch, we want to preserve the source
@@ -580,32 +757,118 @@ func (resolver *refResolver) expandTagInline(obj map[string]interface{}, set set
 						p := prefixes[i]
 						if strings.HasPrefix(ptr, p+"/") {
 							p = p[:len(p)-1]
-							t, _ := jsonptr.Get(target, p)
-							t = deepcopy.Copy(t)
-							jsonptr.Set(&target.data, p, t)
+							t, _ := getPointer(target, p)
+							t = deepCopy(t)
+							setPointer(&target.data, p, t)
 							break
 						}
 						i--
 					}
 					prefixes = append(prefixes[:i+1], ptr) // clear longer prefixes and append this one
-					if err := jsonptr.Set(&target.data, ptr, v); err != nil {
+					if err := setPointer(&target.data, ptr, v); err != nil {
 						return resolver.Error(&loc{l.Path, l.Ptr + "/" + k}, err)
 					}
+					overrides = append(overrides, override{ptr, resolver.sources.originsOf(l.Property(k))})
 				}
 			}
+			targetX.Reorder(keys)
 		case []interface{}:
-			// TODO
-			return resolver.Errorf(l, "inlining of array not yet implemented")
+			// Overrides are applied in their order: "<index>" replaces an item,
+			// "<index>/<pointer>" overrides a value inside an item, "-" (or the
+			// length of the array) appends an item.
+			replDollar := strings.NewReplacer("~2", "$")
+			for _, k := range obj.Keys() {
+				if len(k) > 0 && k[0] == '$' { // skip $inline
+					continue
+				}
+				v, _ := obj.Get(k)
+				kl := l.Property(k)
+				err = resolver.expand(node{v, func(data interface{}) {
+					v = data
+				}, kl})
+				if err != nil {
+					return err
+				}
+				// The override may be patched by a following one
+				v = deepCopy(v)
+
+				index, rest, isDeep := strings.Cut(k, "/")
+				i := len(targetX)
+				if index != "-" {
+					i, err = strconv.Atoi(index)
+					if err != nil || i < 0 || i > len(targetX) || index != strconv.Itoa(i) {
+						return resolver.Errorf(&kl, "invalid array index %q", index)
+					}
+				}
+				switch {
+				case isDeep:
+					if i == len(targetX) {
+						return resolver.Errorf(&kl, "invalid array index %q", index)
+					}
+					ptr := "/" + replDollar.Replace(rest)
+					if err := setPointer(&targetX[i], ptr, v); err != nil {
+						return resolver.Error(&kl, err)
+					}
+					overrides = append(overrides, override{"/" + index + ptr, resolver.sources.originsOf(kl)})
+					continue
+				case i == len(targetX):
+					targetX = append(targetX, v)
+				default:
+					targetX[i] = v
+				}
+				overrides = append(overrides, override{"/" + strconv.Itoa(i), resolver.sources.originsOf(kl)})
+			}
+			// The array may have been reallocated by appends
+			set(targetX)
 		default:
 			return resolver.Errorf(l, "inlined scalar value can't be patched")
 		}
 	}
 
+	resolver.sources.copy(*l, target.loc)
+	for _, o := range overrides {
+		resolver.sources.setOrigins(loc{l.Path, l.Ptr + o.ptr}, o.origins)
+	}
+
 	return nil
 }
 
-func (resolver *refResolver) resolveAndExpand(link string, relativeTo *loc) (n *node, err error) {
-	n, err = resolver.resolve(link, relativeTo)
+// injectedFrom returns the path of the document that the content at ptr of
+// the root document comes from once the fragments enclosing ptr are injected.
+func (resolver *refResolver) injectedFrom(ptr string) string {
+	from, longest := resolver.rootPath, -1
+	for p, sourcePath := range resolver.inject {
+		if len(p) > longest && strings.HasPrefix(ptr, p+"/") {
+			from, longest = sourcePath, len(p)
+		}
+	}
+	return from
+}
+
+// isRefTo returns true if v, located in the document at pth, is a $ref to target.
+func isRefTo(v interface{}, pth string, target loc) bool {
+	obj, isObj := v.(*object)
+	if !isObj {
+		return false
+	}
+	link, isString := stringProp(obj, "$ref")
+	if !isString {
+		return false
+	}
+	file, ptr, _ := strings.Cut(link, "#")
+	file, err := resolveLocation(pth, file)
+	return err == nil && file == target.Path && ptr == target.Ptr
+}
+
+// sameJSON returns true if a and b have the same JSON value.
+func sameJSON(a, b interface{}) bool {
+	ja, errA := appendCanonicalJSON(nil, a)
+	jb, errB := appendCanonicalJSON(nil, b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
+
+func (resolver *refResolver) resolveAndExpand(link string, relativeTo *loc, isRef bool) (n *node, err error) {
+	n, err = resolver.resolve(link, relativeTo, isRef)
 	if err != nil {
 		if _, isExpandErr := err.(*errExpand); !isExpandErr {
 			err = resolver.Error(relativeTo, err)
@@ -616,24 +879,50 @@ func (resolver *refResolver) resolveAndExpand(link string, relativeTo *loc) (n *
 	return
 }
 
-func ExpandRefs(rdoc *interface{}, docURL *url.URL, trace func(string)) error {
+// ExpandRefs expands the document (loaded from docURL) in place.
+//
+// Referenced documents are loaded with ld (see [loader.FS] for the file system).
+func ExpandRefs(rdoc *interface{}, docURL *url.URL, ld *loader, trace func(string)) error {
+	return expandRefs(rdoc, docURL, ld, trace, false)
+}
+
+// BundleRefs is like [ExpandRefs], but the targets of $ref to external
+// documents are hoisted into the section of components matching the location
+// of the $ref (/components/schemas, /components/parameters... or /definitions,
+// /parameters, /responses for Swagger 2.0) under a collision-free name, and the
+// $ref is rewritten to point there. Targets of $ref for which the kind of
+// component can't be determined are injected as with ExpandRefs.
+func BundleRefs(rdoc *interface{}, docURL *url.URL, ld *loader, trace func(string)) error {
+	return expandRefs(rdoc, docURL, ld, trace, true)
+}
+
+func expandRefs(rdoc *interface{}, docURL *url.URL, ld *loader, trace func(string), bundle bool) error {
 	if len(docURL.Fragment) > 0 {
 		panic("URL fragment unexpected for initial document")
 	}
 
-	cwd, _ := os.Getwd()
-
-	path := path.Clean(docURL.Path)
+	rootPath := docURL.Path
+	if !isRemote(rootPath) {
+		rootPath = path.Clean(rootPath)
+	}
 	resolver := refResolver{
-		basePath: filepath.ToSlash(cwd),
-		rootPath: path,
+		basePath: ld.WorkDir(),
+		rootPath: rootPath,
 		docs: map[string]*interface{}{
-			path: rdoc,
+			rootPath: rdoc,
 		},
 		inject:  make(map[string]string),
 		visited: make(map[loc]bool),
+		loader:  ld,
+		sources: ld.sources,
 		trace:   trace,
 	}
+	if ld.sources != nil {
+		ld.sources.root = rootPath
+	}
+	if root, isObj := (*rdoc).(*object); isObj && bundle {
+		resolver.bundle = newBundler(root)
+	}
 
 	// First step:
 	// - load referenced documents
@@ -641,7 +930,7 @@ func ExpandRefs(rdoc *interface{}, docURL *url.URL, trace func(string)) error {
 	// - replace $inline, $merge
 	err := resolver.expand(node{*rdoc, func(data interface{}) {
 		*rdoc = data
-	}, loc{Path: path}})
+	}, loc{Path: rootPath}})
 
 	if err != nil {
 		return err
@@ -650,19 +939,39 @@ func ExpandRefs(rdoc *interface{}, docURL *url.URL, trace func(string)) error {
 	// Second step:
 	// Inject content from external documents pointed by $ref.
 	// The inject path is the same as the path in the source doc.
-	for ptr, sourcePath := range resolver.inject {
+	// Sorted order ensures a fragment is injected before fragments nested in it.
+	for _, ptr := range sortedKeys(resolver.inject) {
+		sourcePath := resolver.inject[ptr]
 		// log.Println(ptr, sourcePath)
 
-		if _, err := jsonptr.Get(*rdoc, ptr); err != nil {
-			return fmt.Errorf("%s: content replaced from %s", ptr, sourcePath)
-		}
-		target, err := jsonptr.Get(*resolver.docs[sourcePath], ptr)
+		target, err := getPointer(*resolver.docs[sourcePath], ptr)
 		if err != nil {
 			return fmt.Errorf("%s#%s has disappeared after replacement of $inline and $merge: %v", sourcePath, ptr, err)
 		}
-		if err = jsonptr.Set(rdoc, ptr, target); err != nil {
+		if current, err := getPointer(*rdoc, ptr); err == nil {
+			// Only a $ref to the fragment, or the same content (such as the
+			// fragment itself, injected with an enclosing fragment), may be replaced
+			if from := resolver.injectedFrom(ptr); from != sourcePath && !isRefTo(current, from, loc{sourcePath, ptr}) && !sameJSON(current, target) {
+				return resolver.Errorf(&loc{rootPath, ptr}, "conflicts with fragment %q imported by $ref", (&loc{sourcePath, ptr}).Rel(resolver.basePath))
+			}
+			err = setPointer(rdoc, ptr, target)
+		} else if root, isObj := (*rdoc).(*object); isObj {
+			// The location doesn't exist yet in the root document
+			err = setCreate(root, jsonptr.MustParse(ptr), target)
+		}
+		if err != nil {
 			return fmt.Errorf("%s#%s: %v", sourcePath, ptr, err)
 		}
+		resolver.sources.copy(loc{rootPath, ptr}, loc{sourcePath, ptr})
+	}
+
+	if resolver.bundle != nil {
+		if err = resolver.bundle.inject(); err != nil {
+			return err
+		}
+		for _, h := range resolver.bundle.hoisted {
+			resolver.sources.copy(loc{rootPath, h.ptr}, h.from)
+		}
 	}
 
 	// Third step:
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"encoding/json"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
-	"reflect"
 	"sort"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func assertString(t *testing.T, got, expected string) bool {
@@ -92,7 +96,12 @@ func runExpandRefs(t testing.TB, path string) {
 		t.Fatal("no input file")
 	}
 
-	expected, err := loadFile(filepath.Join(filepath.FromSlash(path), "result.json"))
+	if b, err := os.ReadFile(path + "/error.txt"); err == nil {
+		runExpandRefsError(t, inputPath, strings.TrimSpace(string(b)))
+		return
+	}
+
+	expected, err := loadFile(filepath.Join(filepath.FromSlash(path), "result.json"), nil)
 	if err != nil {
 		t.Fatalf("%s/result.json: %v", path, err)
 	}
@@ -100,26 +109,39 @@ func runExpandRefs(t testing.TB, path string) {
 	switch tb := t.(type) {
 	case *testing.T:
 		var out interface{}
-		err = processFile(inputPath, func(result interface{}) error {
+		err = processFile(inputPath, &loader{}, func(result interface{}) error {
 			out = result
 			return nil
-		}, &debugFlags{})
+		}, &options{})
 		if err != nil {
 			t.Fatal(err)
 		}
 
-		if !reflect.DeepEqual(out, expected) {
+		if !equalJSON(out, expected) {
 			b, err := json.Marshal(out)
 			_ = err
 			var bFmt bytes.Buffer
 			json.Indent(&bFmt, b, "", "    ")
 			t.Errorf("output doesn't match:\n%s", bFmt.String())
 		}
+
+		// Same through io/fs
+		out = nil
+		err = processFile(inputPath, &loader{fsys: os.DirFS(".")}, func(result interface{}) error {
+			out = result
+			return nil
+		}, &options{})
+		if err != nil {
+			t.Fatal("fs:", err)
+		}
+		if !equalJSON(out, expected) {
+			t.Errorf("fs: output doesn't match: %#v", out)
+		}
 	case *testing.B:
 		for i := 0; i < tb.N; i++ {
-			_ = processFile(inputPath, func(interface{}) error {
+			_ = processFile(inputPath, &loader{}, func(interface{}) error {
 				return nil
-			}, &debugFlags{})
+			}, &options{})
 		}
 	}
 }
@@ -131,3 +153,243 @@ func TestInlineIndirect(t *testing.T) {
 func Benchmark43(b *testing.B) {
 	runExpandRefs(b, "testdata/43-inline-overrides-deep")
 }
+
+// runExpandRefsError checks that the processing of inputPath fails with an
+// error that contains expected (the content of error.txt instead of result.json).
+func runExpandRefsError(t testing.TB, inputPath string, expected string) {
+	for _, ld := range []*loader{{}, {fsys: os.DirFS(".")}} {
+		err := processFile(inputPath, ld, func(interface{}) error { return nil }, &options{})
+		if err == nil {
+			t.Fatal("error expected")
+		}
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("got error %q, expected %q", err, expected)
+		}
+	}
+}
+
+func TestExpandRefsHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer srv.Close()
+
+	// indirect.yml has a relative link that must be resolved against its URL
+	inputPath := filepath.Join(t.TempDir(), "input.yml")
+	err := os.WriteFile(inputPath, []byte(`---
+swagger: "2.0"
+info:
+  $inline: `+srv.URL+`/41-inline-indirect/indirect.yml#/info
+  version: "0.0.1"
+paths:
+  $ref: `+srv.URL+`/common/root-404.yml#/paths
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := loadFile("testdata/41-inline-indirect/result.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out interface{}
+	err = processFile(inputPath, &loader{}, func(result interface{}) error {
+		out = result
+		return nil
+	}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalJSON(out, expected) {
+		t.Errorf("output doesn't match: %#v", out)
+	}
+
+	err = os.WriteFile(inputPath, []byte(`---
+swagger: "2.0"
+info:
+  $ref: `+srv.URL+`/common/missing.yml#/info
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = processFile(inputPath, &loader{}, func(interface{}) error { return nil }, &options{})
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	t.Log(err)
+	if !strings.Contains(err.Error(), srv.URL+"/common/missing.yml") {
+		t.Errorf("URL missing from error: %q", err)
+	}
+
+	// A server that doesn't answer doesn't block forever
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer slow.Close()
+	defer func(c *http.Client) { httpClient = c }(httpClient)
+	httpClient = &http.Client{Timeout: 100 * time.Millisecond}
+	err = os.WriteFile(inputPath, []byte(`---
+swagger: "2.0"
+info:
+  $ref: `+slow.URL+`/info.yml#/info
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = processFile(inputPath, &loader{}, func(interface{}) error { return nil }, &options{})
+	if err == nil {
+		t.Fatal("error expected")
+	}
+}
+
+func TestProcessReader(t *testing.T) {
+	f, err := os.Open("testdata/10-ref-ext/input.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	expected, err := loadFile("testdata/10-ref-ext/result.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out interface{}
+	err = processReader(f, "yaml", "testdata/10-ref-ext", &loader{}, func(result interface{}) error {
+		out = result
+		return nil
+	}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalJSON(out, expected) {
+		t.Errorf("output doesn't match: %#v", out)
+	}
+}
+
+func TestExpandRefsMap(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "input.yml")
+	err := os.WriteFile(inputPath, []byte(`---
+swagger: "2.0"
+info:
+  $inline: https://schemas.example.com/41-inline-indirect/indirect.yml#/info
+  version: "0.0.1"
+paths:
+  $ref: https://schemas.example.com/common/root-404.yml#/paths
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := loadFile("testdata/41-inline-indirect/result.json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ld loader
+	if err = ld.AddMapping("https://schemas.example.com/=testdata/"); err != nil {
+		t.Fatal(err)
+	}
+	// Longest prefix wins
+	if err = ld.AddMapping("https://schemas.example.com/common/=testdata/missing/"); err != nil {
+		t.Fatal(err)
+	}
+	if err = ld.AddMapping("https://schemas.example.com/common/root-=testdata/common/root-"); err != nil {
+		t.Fatal(err)
+	}
+
+	var out interface{}
+	err = processFile(inputPath, &ld, func(result interface{}) error {
+		out = result
+		return nil
+	}, &options{})
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	t.Log(err)
+	if !strings.Contains(err.Error(), `"https://schemas.example.com/common/info.yml"`) || !strings.Contains(err.Error(), "testdata/missing/info.yml") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	ld.mappings = ld.mappings[:0]
+	if err = ld.AddMapping("https://schemas.example.com/=testdata/"); err != nil {
+		t.Fatal(err)
+	}
+	err = processFile(inputPath, &ld, func(result interface{}) error {
+		out = result
+		return nil
+	}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalJSON(out, expected) {
+		t.Errorf("output doesn't match: %#v", out)
+	}
+}
+
+func TestExpandRefsMapFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"api/openapi.yaml": {Data: []byte(`
+openapi: 3.1.0
+info:
+  $inline: common/info.json#/info
+  description: !text common/description.md
+paths:
+  $ref: paths.yml#/paths
+`)},
+		"api/paths.yml": {Data: []byte(`
+paths:
+  /:
+    get:
+      responses:
+        "200":
+          $inline: common/info.json#/x-ok
+`)},
+		"api/common/info.json":      {Data: []byte(`{"info":{"title":"Test","version":"1.0"},"x-ok":{"description":"OK"}}`)},
+		"api/common/description.md": {Data: []byte(`Embedded`)},
+	}
+
+	var out interface{}
+	err := processFile("api/openapi.yaml", &loader{fsys: fsys}, func(result interface{}) error {
+		out = result
+		return nil
+	}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(out)
+	assertString(t, string(b), `{"openapi":"3.1.0","info":{"title":"Test","version":"1.0","description":"Embedded"},"paths":{"/":{"get":{"responses":{"200":{"description":"OK"}}}}}}`)
+
+	err = processFile("api/missing.yaml", &loader{fsys: fsys}, func(interface{}) error { return nil }, &options{})
+	if err == nil {
+		t.Error("error expected")
+	}
+	fsys["api/openapi.yaml"] = &fstest.MapFile{Data: []byte("info: {$ref: 'common/missing.json#/info'}\n")}
+	err = processFile("api/openapi.yaml", &loader{fsys: fsys}, func(interface{}) error { return nil }, &options{})
+	if err == nil {
+		t.Fatal("error expected")
+	}
+	assertString(t, err.Error()[:len("api/openapi.yaml#/info: ")], "api/openapi.yaml#/info: ")
+}
+
+func TestInlineArrayErrors(t *testing.T) {
+	for _, override := range []string{`"3": x`, `"01": x`, `"2/name": x`, `"a": x`} {
+		fsys := fstest.MapFS{
+			"api.yaml": {Data: []byte(`
+openapi: 3.1.0
+info: {title: Test, version: "1.0"}
+x-list:
+  $inline: '#/x-source'
+  ` + override + `
+x-source: [a, b]
+`)},
+		}
+		err := processFile("api.yaml", &loader{fsys: fsys}, func(interface{}) error { return nil }, &options{})
+		if err == nil {
+			t.Errorf("%s: error expected", override)
+			continue
+		}
+		if !strings.Contains(err.Error(), "invalid array index") {
+			t.Errorf("%s: unexpected error: %v", override, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dolmen-go/jsonptr"
+)
+
+// position is the line and column of a node in its source document. Both are
+// 0 if unknown (JSON).
+type position struct {
+	Line, Column int
+}
+
+// positions maps the JSON pointers of the nodes of a document to their
+// position in the source.
+type positions map[string]position
+
+// addNodes records the nodes of v (at ptr) which are not already in pos, with
+// an unknown position.
+func (pos positions) addNodes(v interface{}, ptr string) {
+	if _, exists := pos[ptr]; !exists {
+		pos[ptr] = position{}
+	}
+	switch v := v.(type) {
+	case *object:
+		for k, item := range v.All() {
+			pos.addNodes(item, ptr+"/"+jsonptr.EscapeString(k))
+		}
+	case []interface{}:
+		for i, item := range v {
+			pos.addNodes(item, ptr+"/"+strconv.Itoa(i))
+		}
+	}
+}
+
+// source is the origin of a node: its location and, if known, its position
+// in the source document.
+type source struct {
+	loc
+	position
+}
+
+// sources records the origin of the nodes of the documents loaded by a
+// [loader], to map the result of the processing back to the source documents.
+//
+// A node comes from the document it is in, unless it has been replaced during
+// the processing ($ref, $inline, $merge...) with a copy of a node from
+// elsewhere: copies are recorded by location (see [sources.copy]).
+//
+// A nil *sources records nothing.
+type sources struct {
+	root   string                    // location of the root document
+	nodes  map[string]positions      // location of a document -> its nodes
+	copies map[string]map[string]loc // location of a document -> pointer of a copy -> origin
+}
+
+// addDoc records the nodes of doc, loaded from pth, and their positions.
+func (s *sources) addDoc(pth string, doc *object, pos positions) {
+	if s == nil {
+		return
+	}
+	pos.addNodes(doc, "")
+	if s.nodes == nil {
+		s.nodes = make(map[string]positions)
+	}
+	s.nodes[pth] = pos
+}
+
+// origin returns the location the node at l comes from: the origin of the
+// nearest copied node above it (or itself), or else l.
+func (s *sources) origin(l loc) loc {
+	copies := s.copies[l.Path]
+	for p := l.Ptr; ; {
+		if from, copied := copies[p]; copied {
+			return loc{from.Path, from.Ptr + l.Ptr[len(p):]}
+		}
+		i := strings.LastIndexByte(p, '/')
+		if i < 0 {
+			return l
+		}
+		p = p[:i]
+	}
+}
+
+// originsOf returns the origin of the node at l and of the copied nodes below
+// it, by pointer relative to l.
+func (s *sources) originsOf(l loc) map[string]loc {
+	if s == nil {
+		return nil
+	}
+	origins := map[string]loc{"": s.origin(l)}
+	for p, from := range s.copies[l.Path] {
+		if rest, below := strings.CutPrefix(p, l.Ptr); below && strings.HasPrefix(rest, "/") {
+			origins[rest] = from
+		}
+	}
+	return origins
+}
+
+// setOrigins records origins (see [sources.originsOf]) as the origins of the
+// node at l and of the nodes below it.
+func (s *sources) setOrigins(l loc, origins map[string]loc) {
+	if s == nil {
+		return
+	}
+	copies := s.copies[l.Path]
+	if copies == nil {
+		if s.copies == nil {
+			s.copies = make(map[string]map[string]loc)
+		}
+		copies = make(map[string]loc)
+		s.copies[l.Path] = copies
+	}
+	for p := range copies {
+		if rest, below := strings.CutPrefix(p, l.Ptr); below && (rest == "" || rest[0] == '/') {
+			delete(copies, p)
+		}
+	}
+	for rel, from := range origins {
+		copies[l.Ptr+rel] = from
+	}
+}
+
+// copy records that the node at dst is a copy of the node at src.
+func (s *sources) copy(dst, src loc) {
+	if s == nil {
+		return
+	}
+	s.setOrigins(dst, s.originsOf(src))
+}
+
+// copyPtr is like [sources.copy] for nodes of the root document, except that
+// the properties of dst named in keep keep their origin.
+func (s *sources) copyPtr(dst, src string, keep ...string) {
+	if s == nil {
+		return
+	}
+	dstLoc := loc{s.root, dst}
+	kept := make([]map[string]loc, len(keep))
+	for i, k := range keep {
+		kept[i] = s.originsOf(dstLoc.Property(k))
+	}
+	s.copy(dstLoc, loc{s.root, src})
+	for i, k := range keep {
+		s.setOrigins(dstLoc.Property(k), kept[i])
+	}
+}
+
+// source returns the origin of the node at ptr in the root document. ok is
+// false if the node doesn't come from a loaded document.
+func (s *sources) source(ptr string) (src source, ok bool) {
+	if s == nil {
+		return
+	}
+	src.loc = s.origin(loc{s.root, ptr})
+	src.position, ok = s.nodes[src.Path][src.Ptr]
+	return
+}
+
+// sourceMap returns an object that maps the JSON pointers of doc (the root
+// document, after processing) to their origin (file, pointer, line and column)
+// recorded in src. Files are relative to basePath. Nodes of unknown origin are
+// omitted.
+func sourceMap(doc interface{}, src *sources, basePath string) *object {
+	m := new(object)
+	var walk func(v interface{}, ptr string)
+	walk = func(v interface{}, ptr string) {
+		if s, ok := src.source(ptr); ok {
+			l := s.loc.Rel(basePath)
+			entry := newObject(4)
+			entry.Set("file", l.Path)
+			entry.Set("pointer", l.Ptr)
+			if s.Line > 0 {
+				entry.Set("line", s.Line)
+				entry.Set("column", s.Column)
+			}
+			m.Set(ptr, entry)
+		}
+		switch v := v.(type) {
+		case *object:
+			for k, item := range v.All() {
+				walk(item, ptr+"/"+jsonptr.EscapeString(k))
+			}
+		case []interface{}:
+			for i, item := range v {
+				walk(item, ptr+"/"+strconv.Itoa(i))
+			}
+		}
+	}
+	walk(doc, "")
+	return m
+}
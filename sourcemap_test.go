@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSourceMap(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"input.yml": `---
+openapi: 3.1.0
+info:
+  $merge: info.json#/info
+  title: API
+paths:
+  /users:
+    $inline: paths.yml#/user
+    get/summary: List
+tags:
+  $inline: paths.yml#/tags
+  "-": {name: b}
+`,
+		"info.json": `{"info":{"version":"1.0","title":"Ignored"}}`,
+		"paths.yml": `---
+user:
+  get:
+    summary: Get
+    responses:
+      "200":
+        description: OK
+tags:
+  - name: a
+`,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ld := loader{sources: new(sources)}
+	var srcMap *object
+	err := processFile(filepath.Join(dir, "input.yml"), &ld, func(doc interface{}) error {
+		srcMap = sourceMap(doc, ld.sources, filepath.ToSlash(dir))
+		return nil
+	}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := appendJSON(nil, srcMap)
+	t.Logf("%s", b)
+
+	for ptr, expected := range map[string]map[string]interface{}{
+		"":                           {"file": "input.yml", "pointer": "", "line": 2, "column": 1},
+		"/info":                      {"file": "input.yml", "pointer": "/info", "line": 4, "column": 3},
+		"/info/title":                {"file": "input.yml", "pointer": "/info/title", "line": 5, "column": 10},
+		"/info/version":              {"file": "info.json", "pointer": "/info/version"},
+		"/paths/~1users":             {"file": "paths.yml", "pointer": "/user", "line": 3, "column": 3},
+		"/paths/~1users/get":         {"file": "paths.yml", "pointer": "/user/get", "line": 4, "column": 5},
+		"/paths/~1users/get/summary": {"file": "input.yml", "pointer": "/paths/~1users/get~1summary", "line": 9, "column": 18},
+		"/paths/~1users/get/responses/200/description": {"file": "paths.yml", "pointer": "/user/get/responses/200/description", "line": 7, "column": 22},
+		"/tags/0":      {"file": "paths.yml", "pointer": "/tags/0", "line": 9, "column": 5},
+		"/tags/1":      {"file": "input.yml", "pointer": "/tags/-", "line": 12, "column": 8},
+		"/tags/1/name": {"file": "input.yml", "pointer": "/tags/-/name", "line": 12, "column": 15},
+	} {
+		if got, _ := srcMap.Get(ptr); !equalJSON(got, expected) {
+			t.Errorf("%q: got %v, expected %v", ptr, got, expected)
+		}
+	}
+	if srcMap.Len() != 17 {
+		t.Errorf("%d entries", srcMap.Len())
+	}
+
+	// Origins are not recorded by default
+	ld = loader{}
+	err = processFile(filepath.Join(dir, "input.yml"), &ld, func(doc interface{}) error {
+		srcMap = sourceMap(doc, ld.sources, filepath.ToSlash(dir))
+		return nil
+	}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if srcMap.Len() != 0 {
+		t.Errorf("%d entries without sources", srcMap.Len())
+	}
+}
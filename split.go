@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dolmen-go/jsonptr"
+)
+
+// splitMain runs the split subcommand with the arguments that follow it.
+func splitMain(args []string) (int, error) {
+	flags := flag.NewFlagSet("split", flag.ExitOnError)
+	var dir, root string
+	flags.StringVar(&dir, "o", "", "write the files to `directory` (required)")
+	flags.StringVar(&root, "root", "", "`name` of the root document in the output directory; its extension sets the format (default: name of the input file)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s split -o <directory> [-root <name>] <file>\nOptions:\n", os.Args[0])
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || dir == "" {
+		flags.Usage()
+	}
+	arg := flags.Arg(0)
+	if root == "" {
+		root = filepath.Base(arg)
+	}
+
+	absPath, err := filepath.Abs(arg)
+	if err != nil {
+		return 0, err
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var ld loader
+	pth := filepath.ToSlash(absPath)
+	doc, err := ld.Load(pth)
+	if err != nil {
+		return 0, err
+	}
+	return 0, Split(doc, pth, filepath.ToSlash(absDir), root)
+}
+
+// Split writes doc, loaded from src, as a tree of files in the directory dir
+// (both slash separated). Each path item and each component goes to its own
+// file which has the same layout as a full spec: the path item /pets is
+// written to paths/pets.yaml under /paths/~1pets, the schema Pet to
+// components/schemas/Pet.yaml under /components/schemas/Pet. The root
+// document, written to the file root, links to them with $ref.
+//
+// Links are rewritten to stay valid from their new location, so that the
+// processing of the root document gives the same result as doc.
+// The format of the files is given by the extension of root.
+func Split(doc *object, src, dir, root string) error {
+	ext := path.Ext(root)
+	if ext == "" {
+		ext = ".json"
+		root += ext
+	}
+	s := splitter{
+		src:     src,
+		dir:     dir,
+		root:    root,
+		ext:     ext,
+		entries: make(map[string]string),
+		names:   make(map[string]bool),
+	}
+	s.collect(doc)
+
+	// Detach the entries before rewriting the links of the root document
+	var rdoc interface{} = doc
+	values := make([]interface{}, len(s.order))
+	for i, ptr := range s.order {
+		values[i], _ = getPointer(rdoc, ptr)
+		_ = setPointer(&rdoc, ptr, nil)
+	}
+	rewriteLinks(doc, nil, func(link string) string {
+		return s.link(root, link)
+	})
+
+	files := make([]interface{}, 0, len(s.order)+1)
+	names := make([]string, 0, len(s.order)+1)
+	for i, ptr := range s.order {
+		name := s.entries[ptr]
+		p := jsonptr.MustParse(ptr)
+		rewriteLinks(values[i], p, func(link string) string {
+			return s.link(name, link)
+		})
+
+		// Same layout as in the root document
+		partial := values[i]
+		for j := len(p) - 1; j >= 0; j-- {
+			parent := newObject(1)
+			parent.Set(p[j], partial)
+			partial = parent
+		}
+		files = append(files, partial)
+		names = append(names, name)
+
+		ref := newObject(1)
+		ref.Set("$ref", name+"#"+ptr)
+		_ = setPointer(&rdoc, ptr, ref)
+	}
+	files = append(files, doc)
+	names = append(names, root)
+
+	for i, name := range names {
+		var buf bytes.Buffer
+		encode, err := newEncoder(&buf, outputFormat(root), false)
+		if err != nil {
+			return err
+		}
+		if err = encode(files[i]); err != nil {
+			return err
+		}
+		osName := filepath.FromSlash(path.Join(dir, name))
+		if err = os.MkdirAll(filepath.Dir(osName), 0o755); err != nil {
+			return err
+		}
+		if err = writeFile(osName, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitter holds the state of [Split].
+type splitter struct {
+	src  string // location of the source document
+	dir  string // output directory
+	root string // name of the root document, relative to dir
+	ext  string // extension of files
+
+	entries map[string]string // pointer of a node moved to its own file => file name relative to dir
+	order   []string          // pointers of entries, in document order
+	names   map[string]bool   // file names in use (lower case)
+}
+
+// collect registers the nodes that go to their own file: path items and
+// components (/definitions, /parameters, /responses for Swagger 2.0).
+// Nodes that are just a $ref stay in the root document.
+func (s *splitter) collect(doc *object) {
+	if paths, ok := objectProp(doc, "paths"); ok {
+		for _, p := range paths.Keys() {
+			if strings.HasPrefix(p, "/") {
+				name := strings.NewReplacer("/", "_", "{", "", "}", "").Replace(strings.Trim(p, "/"))
+				if name == "" {
+					name = "root"
+				}
+				s.add(paths, jsonptr.Pointer{"paths", p}, "paths/", name)
+			}
+		}
+	}
+
+	if _, isSwagger := doc.Get("swagger"); isSwagger {
+		for _, section := range []string{"definitions", "parameters", "responses"} {
+			s.addSection(doc, jsonptr.Pointer{section})
+		}
+	} else if components, ok := objectProp(doc, "components"); ok {
+		for _, section := range components.Keys() {
+			s.addSection(components, jsonptr.Pointer{"components", section})
+		}
+	}
+}
+
+func (s *splitter) addSection(parent *object, ptr jsonptr.Pointer) {
+	section, ok := objectProp(parent, ptr[len(ptr)-1])
+	if !ok || strings.HasPrefix(ptr[len(ptr)-1], "x-") {
+		return
+	}
+	for _, name := range section.Keys() {
+		if !strings.HasPrefix(name, "x-") {
+			s.add(section, append(ptr[:len(ptr):len(ptr)], name), strings.Join(ptr, "/")+"/", name)
+		}
+	}
+}
+
+// add registers the node at ptr, the property of parent named by the last
+// part of ptr, to be written in dir to a file named from name.
+func (s *splitter) add(parent *object, ptr jsonptr.Pointer, dir, name string) {
+	obj, isObj := objectProp(parent, ptr[len(ptr)-1])
+	if !isObj {
+		return
+	}
+	if _, isRef := obj.Get("$ref"); isRef && obj.Len() == 1 {
+		return
+	}
+
+	name = safeFileName(name)
+	file := dir + name + s.ext
+	for i := 2; s.names[strings.ToLower(file)]; i++ {
+		file = dir + name + "_" + strconv.Itoa(i) + s.ext
+	}
+	s.names[strings.ToLower(file)] = true
+	s.entries[ptr.String()] = file
+	s.order = append(s.order, ptr.String())
+}
+
+// safeFileName replaces the characters of name which are not safe in a file
+// name with '_'.
+func safeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// link rewrites link, found in the file named from, for its new location.
+func (s *splitter) link(from string, link string) string {
+	pth, frag := link, ""
+	if i := strings.IndexByte(link, '#'); i >= 0 {
+		pth, frag = link[:i], link[i:]
+	}
+
+	var target string
+	switch {
+	case pth == "":
+		// Link inside the source document: to the file of the enclosing entry
+		ptr := strings.TrimPrefix(frag, "#")
+		target = path.Join(s.dir, s.root)
+		for p := ptr; p != ""; {
+			if file, ok := s.entries[p]; ok {
+				target = path.Join(s.dir, file)
+				break
+			}
+			i := strings.LastIndexByte(p, '/')
+			if i < 0 {
+				break
+			}
+			p = p[:i]
+		}
+	case isRemote(pth) || isGit(pth) || strings.HasPrefix(pth, "/"):
+		return link
+	default:
+		var err error
+		if target, err = resolveLocation(s.src, pth); err != nil {
+			return link
+		}
+	}
+
+	fromDir := path.Dir(path.Join(s.dir, from))
+	if target == path.Join(s.dir, from) {
+		return frag
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(fromDir), filepath.FromSlash(target))
+	if err != nil {
+		return link
+	}
+	return filepath.ToSlash(rel) + frag
+}
+
+// linkKeywords are the keywords whose value is a link (or an array of links).
+var linkKeywords = map[string]bool{
+	"$ref":       true,
+	"$inline":    true,
+	"$merge":     true,
+	"$deepMerge": true,
+}
+
+// rewriteLinks applies rewrite to the links in v (see [linkKeywords]).
+func rewriteLinks(v interface{}, ptr jsonptr.Pointer, rewrite func(string) string) {
+	switch v := v.(type) {
+	case *object:
+		for k, item := range v.All() {
+			if linkKeywords[k] && !skipRef(ptr) {
+				switch link := item.(type) {
+				case string:
+					v.Set(k, rewrite(link))
+				case []interface{}:
+					for i, l := range link {
+						if l, isString := l.(string); isString {
+							link[i] = rewrite(l)
+						}
+					}
+				}
+				continue
+			}
+			rewriteLinks(item, append(ptr, k), rewrite)
+		}
+	case []interface{}:
+		for i, item := range v {
+			rewriteLinks(item, append(ptr, strconv.Itoa(i)), rewrite)
+		}
+	}
+}
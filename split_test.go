@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// processJSON returns the compact JSON output of the processing of the file pth.
+func processJSON(t *testing.T, pth string) string {
+	t.Helper()
+	var out []byte
+	err := processFile(pth, &loader{}, func(result interface{}) (err error) {
+		out, err = appendJSON(nil, result)
+		return
+	}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestSplit(t *testing.T) {
+	src := t.TempDir()
+	for name, content := range map[string]string{
+		"api.yaml": `openapi: 3.1.0
+info:
+  title: Pets
+  version: "1.0"
+paths:
+  /pets:
+    get:
+      parameters:
+        - $ref: '#/components/parameters/limit'
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                type: array
+                items:
+                  $ref: '#/components/schemas/Pet'
+        default:
+          $ref: common/errors.yaml#/components/responses/Error
+  /pets/{id}:
+    get:
+      parameters:
+        - $ref: '#/paths/~1pets/get/parameters/0'
+      responses:
+        "200":
+          $ref: '#/components/responses/Pet'
+  /:
+    $ref: '#/paths/~1pets'
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        id:
+          type: integer
+        owner:
+          $ref: '#/components/schemas/Owner'
+    Owner:
+      type: object
+      properties:
+        name:
+          type: string
+  parameters:
+    limit:
+      name: limit
+      in: query
+      schema:
+        type: integer
+  responses:
+    Pet:
+      description: A pet
+      content:
+        application/json:
+          schema:
+            $ref: '#/components/schemas/Pet'
+`,
+		"common/errors.yaml": `components:
+  responses:
+    Error:
+      description: Error
+`,
+	} {
+		pth := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(pth), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pth, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	input := filepath.Join(src, "api.yaml")
+	expected := processJSON(t, input)
+
+	doc, err := loadFile(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "out")
+	if err = Split(doc, filepath.ToSlash(input), filepath.ToSlash(out), "openapi.yaml"); err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	filepath.WalkDir(out, func(pth string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(out, pth)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	sort.Strings(files)
+	if !reflect.DeepEqual(files, []string{
+		"components/parameters/limit.yaml",
+		"components/responses/Pet.yaml",
+		"components/schemas/Owner.yaml",
+		"components/schemas/Pet.yaml",
+		"openapi.yaml",
+		"paths/pets.yaml",
+		"paths/pets_id.yaml",
+	}) {
+		t.Errorf("files: %q", files)
+	}
+
+	root, err := loadFile(filepath.Join(out, "openapi.yaml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, _ := getPointer(root, "/paths/~1pets/$ref")
+	assertString(t, ref.(string), "paths/pets.yaml#/paths/~1pets")
+	pet, err := loadFile(filepath.Join(out, "components", "responses", "Pet.yaml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := appendJSON(nil, pet)
+	assertString(t, string(b), `{"components":{"responses":{"Pet":{"description":"A pet","content":{"application/json":{"schema":{"$ref":"../schemas/Pet.yaml#/components/schemas/Pet"}}}}}}}`)
+
+	assertString(t, processJSON(t, filepath.Join(out, "openapi.yaml")), expected)
+}
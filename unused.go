@@ -13,18 +13,18 @@ func removeEmptyObject(rdoc *interface{}, pointer string) {
 	if err != nil {
 		panic(fmt.Errorf("%s: %v", pointer, err))
 	}
-	parentRaw, err := ptr[:len(ptr)-1].In(*rdoc)
+	parentRaw, err := getIn(*rdoc, ptr[:len(ptr)-1])
 	if err != nil {
 		return
 	}
-	parent, isObj := parentRaw.(map[string]interface{})
-	if !isObj || len(parent) == 0 {
+	parent, isObj := parentRaw.(*object)
+	if !isObj || parent.Len() == 0 {
 		return
 	}
 	key := ptr[len(ptr)-1]
-	obj, isObj := parent[key].(map[string]interface{})
-	if isObj && len(obj) == 0 {
-		delete(parent, key)
+	obj, isObj := objectProp(parent, key)
+	if isObj && obj.Len() == 0 {
+		parent.Delete(key)
 	}
 }
 
@@ -34,12 +34,12 @@ func removeEmptyObject(rdoc *interface{}, pointer string) {
 // or $merge have been injected and are not needed anymore.
 func CleanUnused(rdoc *interface{}) error {
 
-	root, isObj := (*rdoc).(map[string]interface{})
+	root, isObj := (*rdoc).(*object)
 	if !isObj {
 		return errors.New("root is not an object")
 	}
 
-	if paths, hasPaths := root["paths"]; hasPaths {
+	if paths, hasPaths := root.Get("paths"); hasPaths {
 
 		var components []string
 
@@ -65,15 +65,15 @@ func CleanUnused(rdoc *interface{}) error {
 		// Collect all defined components.
 		unused := make(map[string]bool)
 		for _, p := range components {
-			compRaw, err := jsonptr.Get(root, p)
+			compRaw, err := getPointer(root, p)
 			if err != nil {
 				continue
 			}
-			comp, compObj := compRaw.(map[string]interface{})
+			comp, compObj := compRaw.(*object)
 			if !compObj {
 				continue
 			}
-			for k := range comp {
+			for _, k := range comp.Keys() {
 				unused[p+"/"+jsonptr.EscapeString(k)] = true
 			}
 		}
@@ -102,7 +102,7 @@ func CleanUnused(rdoc *interface{}) error {
 				return ref, err
 			}
 			targetPtr.Grow(20)
-			target, err := targetPtr.In(root)
+			target, err := getIn(root, targetPtr)
 			if err != nil { // should not happen if
 				return ref, fmt.Errorf("%v -> %v: %v", ptr, link, err)
 			}
@@ -116,13 +116,13 @@ func CleanUnused(rdoc *interface{}) error {
 		}
 
 		// If there are securitySchemes components, look for references.
-		if secSchemesAny, err := jsonptr.Get(*rdoc, `/components/securitySchemes`); err == nil {
-			if secSchemes, isObj := secSchemesAny.(map[string]any); isObj && len(secSchemes) > 0 {
+		if secSchemesAny, err := getPointer(*rdoc, `/components/securitySchemes`); err == nil {
+			if secSchemes, isObj := secSchemesAny.(*object); isObj && secSchemes.Len() > 0 {
 
-				markUsedSecuritySchemes := func(ptr string, doc map[string]any) {
+				markUsedSecuritySchemes := func(ptr string, doc *object) {
 					for _, req := range iterSecurity(ptr, doc) {
 						// https://spec.openapis.org/oas/v3.1.1.html#security-requirement-object
-						for name := range req {
+						for _, name := range req.Keys() {
 							// fmt.Println("used: " + `/components/securitySchemes/` + jsonptr.EscapeString(name))
 							// TODO: signal if the securityScheme is not present in /components/securitySchemes
 							delete(unused, `/components/securitySchemes/`+jsonptr.EscapeString(name))
@@ -148,7 +148,7 @@ func CleanUnused(rdoc *interface{}) error {
 				}
 			}
 			// log.Printf("%s: unused", p)
-			_, err = jsonptr.Delete(rdoc, p)
+			_, err = deletePointer(rdoc, p)
 			if err != nil {
 				panic("This should not happen")
 			}
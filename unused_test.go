@@ -3,5 +3,5 @@ package main
 import "testing"
 
 func TestUnusedSecuritySchemes01(t *testing.T) {
-	runExpandRefs(t, "testdata/80-unused-securityschemes-01")
+	runExpandRefs(t, "testdata/80-unused-securitySchemes-01")
 }
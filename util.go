@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"iter"
 	"sort"
 	"strconv"
@@ -8,7 +10,7 @@ import (
 	"github.com/dolmen-go/jsonptr"
 )
 
-func sortedKeys(obj map[string]interface{}) (keys []string) {
+func sortedKeys[V any](obj map[string]V) (keys []string) {
 	keys = make([]string, 0, len(obj))
 	for k := range obj {
 		keys = append(keys, k)
@@ -17,17 +19,17 @@ func sortedKeys(obj map[string]interface{}) (keys []string) {
 	return
 }
 
-func objectProp(obj map[string]interface{}, key string) (value map[string]interface{}, ok bool) {
-	v, ok := obj[key]
+func objectProp(obj *object, key string) (value *object, ok bool) {
+	v, ok := obj.Get(key)
 	if !ok {
 		return nil, false
 	}
-	value, ok = v.(map[string]interface{})
+	value, ok = v.(*object)
 	return
 }
 
-func stringProp(obj map[string]interface{}, key string) (value string, ok bool) {
-	v, ok := obj[key]
+func stringProp(obj *object, key string) (value string, ok bool) {
+	v, ok := obj.Get(key)
 	if !ok {
 		return "", false
 	}
@@ -35,6 +37,15 @@ func stringProp(obj map[string]interface{}, key string) (value string, ok bool)
 	return
 }
 
+func arrayProp(obj *object, key string) (value []interface{}, ok bool) {
+	v, ok := obj.Get(key)
+	if !ok {
+		return nil, false
+	}
+	value, ok = v.([]interface{})
+	return
+}
+
 // iterArray allow to browse an array of items by casting each element to type T.
 //
 // Items which are not of type T are skipped.
@@ -70,13 +81,13 @@ func seq2Noop[K any, V any](yield func(K, V) bool) {
 	return
 }
 
-func iterObjectPtr[T any](ptr string, obj map[string]any) iter.Seq2[string, T] {
-	if len(obj) == 0 {
+func iterObjectPtr[T any](ptr string, obj *object) iter.Seq2[string, T] {
+	if obj.Len() == 0 {
 		return seq2Noop[string, T]
 	}
 
 	return func(yield func(string, T) bool) {
-		for key, valueAny := range obj {
+		for key, valueAny := range obj.All() {
 			if value, isType := valueAny.(T); isType {
 				if !yield(ptr+"/"+jsonptr.EscapeString(key), value) {
 					return
@@ -86,8 +97,8 @@ func iterObjectPtr[T any](ptr string, obj map[string]any) iter.Seq2[string, T] {
 	}
 }
 
-func propertyPtr[T any](ptr string, doc map[string]any, prop string) (string, T, bool) {
-	valueAny, hasProp := doc[prop]
+func propertyPtr[T any](ptr string, doc *object, prop string) (string, T, bool) {
+	valueAny, hasProp := doc.Get(prop)
 	if !hasProp {
 		var v T
 		return "", v, false
@@ -100,8 +111,8 @@ func propertyPtr[T any](ptr string, doc map[string]any, prop string) (string, T,
 	return ptr + "/" + jsonptr.EscapeString(prop), value, true
 }
 
-func iterPropertyPtr[T any](ptr string, doc map[string]any, prop string) iter.Seq2[string, T] {
-	valueAny, hasProp := doc[prop]
+func iterPropertyPtr[T any](ptr string, doc *object, prop string) iter.Seq2[string, T] {
+	valueAny, hasProp := doc.Get(prop)
 	if !hasProp {
 		return seq2Noop[string, T]
 	}
@@ -114,11 +125,11 @@ func iterPropertyPtr[T any](ptr string, doc map[string]any, prop string) iter.Se
 	}
 }
 
-func iterPaths(root any) iter.Seq2[string, map[string]any] {
+func iterPaths(root any) iter.Seq2[string, *object] {
 	/*
-		return func(yield func(string, map[string]any)) {
-			for _, paths := range iterPropertyPtr(``, root.(map[string]any), `paths`) {
-				for ptr, path := range iterObjectPtr[map[string]any](`/paths`, paths) {
+		return func(yield func(string, *object)) {
+			for _, paths := range iterPropertyPtr(``, root.(*object), `paths`) {
+				for ptr, path := range iterObjectPtr[*object](`/paths`, paths) {
 					if !yield(pth, path) {
 						return
 					}
@@ -126,15 +137,11 @@ func iterPaths(root any) iter.Seq2[string, map[string]any] {
 			}
 		}
 	*/
-	pathsAny, ok := (root.(map[string]any))[`paths`]
+	paths, ok := objectProp(root.(*object), `paths`)
 	if !ok {
-		return seq2Noop[string, map[string]any]
+		return seq2Noop[string, *object]
 	}
-	paths, ok := pathsAny.(map[string]any)
-	if !ok {
-		return seq2Noop[string, map[string]any]
-	}
-	return iterObjectPtr[map[string]any](`/paths`, paths)
+	return iterObjectPtr[*object](`/paths`, paths)
 }
 
 var methods = [...]bool{
@@ -148,16 +155,16 @@ var methods = [...]bool{
 	't' + 'r' + 'a': true, // trace
 }
 
-func iterOperations(root any) iter.Seq2[string, map[string]any] {
-	return func(yield func(string, map[string]any) bool) {
+func iterOperations(root any) iter.Seq2[string, *object] {
+	return func(yield func(string, *object) bool) {
 		for ptr, spec := range iterPaths(root) {
-			for k, opAny := range spec {
+			for k, opAny := range spec.All() {
 				if len(k) < 3 {
 					continue
 				}
 				kk := int(k[0]) + int(k[1]) + int(k[2])
 				if kk < len(methods) && methods[kk] {
-					if op, ok := opAny.(map[string]any); ok {
+					if op, ok := opAny.(*object); ok {
 						if !yield(ptr+"/"+jsonptr.EscapeString(k), op) {
 							return
 						}
@@ -168,17 +175,40 @@ func iterOperations(root any) iter.Seq2[string, map[string]any] {
 	}
 }
 
-func iterSecurity(ptr string, doc map[string]any) iter.Seq2[string, map[string]any] {
-	return func(yield func(string, map[string]any) bool) {
-		if opSec, hasSec := doc["security"].([]any); hasSec {
+func iterSecurity(ptr string, doc *object) iter.Seq2[string, *object] {
+	return func(yield func(string, *object) bool) {
+		if opSec, hasSec := arrayProp(doc, "security"); hasSec {
 			/*
-				for p, req := range iterArrayPtr[map[string]any](ptr, opSec) {
+				for p, req := range iterArrayPtr[*object](ptr, opSec) {
 					if !yield(p, req) {
 						return
 					}
 				}
 			*/
-			iterArrayPtr[map[string]any](ptr+"/security", opSec)(yield)
+			iterArrayPtr[*object](ptr+"/security", opSec)(yield)
+		}
+	}
+}
+
+// setCreate sets value at ptr in root, creating the missing objects along the
+// way. Created keys come after the existing keys of their parent.
+func setCreate(root *object, ptr jsonptr.Pointer, value interface{}) error {
+	if len(ptr) == 0 {
+		return errors.New("can't replace the root")
+	}
+	parent := root
+	for i, k := range ptr[:len(ptr)-1] {
+		child, exists := parent.Get(k)
+		if !exists {
+			child = new(object)
+			parent.Set(k, child)
+		}
+		obj, isObj := child.(*object)
+		if !isObj {
+			return fmt.Errorf("%s: not an object", ptr[:i+1])
 		}
+		parent = obj
 	}
+	parent.Set(ptr[len(ptr)-1], value)
+	return nil
 }
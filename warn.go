@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// stringFields are the JSON pointers of the fields that must be strings, but
+// that are easily written unquoted in YAML (version: 1.10).
+var stringFields = []string{
+	"/openapi",
+	"/swagger",
+	"/info/title",
+	"/info/version",
+}
+
+// warnNumbers calls warn for each field of doc (see stringFields) that must be
+// a string but holds a number. Warnings are prefixed by the origin of the
+// field recorded in src, relative to basePath, if known.
+func warnNumbers(doc interface{}, src *sources, basePath string, warn func(string)) {
+	for _, ptr := range stringFields {
+		v, err := getPointer(doc, ptr)
+		if err != nil {
+			continue
+		}
+		var num string
+		switch v := v.(type) {
+		case json.Number:
+			num = string(v)
+		case int, int64, uint64, float64:
+			num = fmt.Sprint(v)
+		default:
+			continue
+		}
+
+		msg := fmt.Sprintf("%s: number %s should be a string (quote it)", ptr, num)
+		if s, ok := src.source(ptr); ok {
+			l := s.loc.Rel(basePath)
+			if s.Line > 0 {
+				msg = fmt.Sprintf("%s:%d:%d: %s", l.Path, s.Line, s.Column, msg)
+			} else {
+				msg = l.String() + ": " + msg
+			}
+		}
+		warn(msg)
+	}
+}
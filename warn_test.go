@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWarnNumbers(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "input.yml"), []byte(`---
+openapi: 3.0.0
+info:
+  $ref: info.json#/info
+paths: {}
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, "info.json"), []byte(`{"info":{"title":"API","version":1.10}}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var warnings []string
+	ld := loader{sources: new(sources)}
+	err = processFile(filepath.Join(dir, "input.yml"), &ld, func(doc interface{}) error {
+		warnNumbers(doc, ld.sources, filepath.ToSlash(dir), func(msg string) {
+			warnings = append(warnings, msg)
+		})
+		return nil
+	}, &options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"info.json#/info/version: /info/version: number 1.10 should be a string (quote it)"}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("got %q, expected %q", warnings, expected)
+	}
+
+	warnings = nil
+	doc, err := loadFile(filepath.Join(dir, "input.yml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Set("swagger", 2)
+	warnNumbers(doc, nil, dir, func(msg string) {
+		warnings = append(warnings, msg)
+	})
+	expected = []string{"/swagger: number 2 should be a string (quote it)"}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("got %q, expected %q", warnings, expected)
+	}
+
+	// YAML: with line and column
+	warnings = nil
+	pos := make(positions)
+	doc, err = loadYAML(strings.NewReader("openapi: 3.1\ninfo:\n  version: 1.0\n"), 0, pos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := sources{root: "/api/openapi.yaml"}
+	src.addDoc("/api/openapi.yaml", doc, pos)
+	warnNumbers(doc, &src, "/api", func(msg string) {
+		warnings = append(warnings, msg)
+	})
+	expected = []string{
+		"openapi.yaml:1:10: /openapi: number 3.1 should be a string (quote it)",
+		"openapi.yaml:3:12: /info/version: number 1.0 should be a string (quote it)",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("got %q, expected %q", warnings, expected)
+	}
+}